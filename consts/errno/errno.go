@@ -124,6 +124,11 @@ var (
 		ErrCode: int64(Err_DirtyData),
 		ErrMsg:  "dirty data",
 	}
+
+	QuotaExceeded = &ErrNo{
+		ErrCode: int64(Err_QuotaExceeded),
+		ErrMsg:  "quota exceeded",
+	}
 )
 
 type Err int64
@@ -140,6 +145,7 @@ const (
 	Err_RecordNotFound     Err = 1000
 	Err_RecordAlreadyExist Err = 1010
 	Err_DirtyData          Err = 1020
+	Err_QuotaExceeded      Err = 1030
 	Err_RPCUserSrvErr      Err = 30001
 	Err_RPCUserAdminSrvErr Err = 30002
 	Err_RPCOrderSrvErr     Err = 30003
@@ -178,6 +184,8 @@ func (p Err) String() string {
 		return "RecordAlreadyExist"
 	case Err_DirtyData:
 		return "DirtyData"
+	case Err_QuotaExceeded:
+		return "QuotaExceeded"
 	case Err_RPCUserSrvErr:
 		return "RPCUserSrvErr"
 	case Err_RPCUserAdminSrvErr:
@@ -230,6 +238,8 @@ func ErrFromString(s string) (Err, error) {
 		return Err_RecordAlreadyExist, nil
 	case "DirtyData":
 		return Err_DirtyData, nil
+	case "QuotaExceeded":
+		return Err_QuotaExceeded, nil
 	case "RPCUserSrvErr":
 		return Err_RPCUserSrvErr, nil
 	case "RPCUserAdminSrvErr":
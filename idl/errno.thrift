@@ -13,6 +13,7 @@ enum Err {
     RecordNotFound     = 1000,
     RecordAlreadyExist = 1010,
     DirtyData          = 1020,
+    QuotaExceeded      = 1030,
 
     RPCUserSrvErr      = 30001,
     RPCUserAdminSrvErr = 30002,
@@ -62,4 +63,5 @@ const ErrNo RPCCartSrvErr = {"ErrCode": Err.RPCCartSrvErr, "ErrMsg": "rpc trip s
 const ErrNo CartSrvErr = {"ErrCode": Err.CartSrvErr, "ErrMsg": "trip service error"}
 const ErrNo RecordNotFound = {"ErrCode": Err.RecordNotFound, "ErrMsg": "record not found"}
 const ErrNo RecordAlreadyExist = {"ErrCode": Err.RecordAlreadyExist, "ErrMsg": "record already exist"}
-const ErrNo DirtyData = {"ErrCode": Err.DirtyData, "ErrMsg": "dirty data"}
\ No newline at end of file
+const ErrNo DirtyData = {"ErrCode": Err.DirtyData, "ErrMsg": "dirty data"}
+const ErrNo QuotaExceeded = {"ErrCode": Err.QuotaExceeded, "ErrMsg": "quota exceeded"}
\ No newline at end of file
@@ -17,6 +17,11 @@ type CommonConfig struct {
 	OTel  model.OTel  `yaml:"otel"`
 }
 
+// NewConsulClient 创建Consul客户端
+func NewConsulClient(registryAddr string) (*api.Client, error) {
+	return api.NewClient(&api.Config{Address: registryAddr})
+}
+
 func GetCommonConfig(registryAddr string) (*CommonConfig, error) {
 	client, err := api.NewClient(&api.Config{Address: registryAddr})
 	if err != nil {
@@ -50,6 +55,9 @@ func GetKvConfig[T any](registryAddr string, keyName string) (*T, error) {
 		fmt.Println("Error getting config:", err)
 		return nil, err
 	}
+	if content == nil {
+		return nil, fmt.Errorf("config key %s not found", keyName)
+	}
 	conf := new(T)
 	err = yaml.Unmarshal(content.Value, &conf)
 	if err != nil {
@@ -0,0 +1,492 @@
+package tenant
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/onebids/onecommon/tools"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 变更历史的操作类型
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// auditSnapshotKey 保存变更前数据的语句设置键
+const auditSnapshotKey = "tenant:audit_snapshot"
+
+// AuditConfig 审计插件配置
+type AuditConfig struct {
+	// 变更历史表名
+	// 默认值: "audit_logs"
+	Table string
+
+	// 创建人字段名
+	// 默认值: "created_by"
+	CreatedByField string
+
+	// 更新人字段名
+	// 默认值: "updated_by"
+	UpdatedByField string
+
+	// 是否只填充创建人和更新人，不记录变更历史
+	// 默认值: false
+	DisableHistory bool
+
+	// 不记录变更历史的表
+	// 默认值: nil
+	SkipTables []string
+}
+
+// NewDefaultAuditConfig 创建带有默认值的审计配置
+func NewDefaultAuditConfig() *AuditConfig {
+	return &AuditConfig{
+		Table:          "audit_logs",
+		CreatedByField: "created_by",
+		UpdatedByField: "updated_by",
+	}
+}
+
+// AuditLog 数据变更历史
+type AuditLog struct {
+	ID         uint64 `gorm:"primarykey"`
+	Table      string `gorm:"column:table_name;size:64;index"`
+	PrimaryKey string `gorm:"size:255;index"`
+	Action     string `gorm:"size:16"`
+	// 变更前的字段值，JSON格式
+	Before string `gorm:"type:text"`
+	// 变更后的字段值，JSON格式
+	After     string `gorm:"type:text"`
+	TenantID  string `gorm:"size:50;index"`
+	UserID    string `gorm:"size:64;index"`
+	TraceID   string `gorm:"size:64"`
+	CreatedAt time.Time
+}
+
+// AuditPlugin 审计GORM插件
+// 创建和更新时从tools.GetUserID填充创建人和更新人，并将变更前后的字段差异写入变更历史表
+// 创建和更新时间沿用GORM对CreatedAt、UpdatedAt字段的自动维护
+type AuditPlugin struct {
+	config *AuditConfig
+
+	// 数据库级隔离时连接所属的租户，为空时从上下文获取
+	tenantID string
+}
+
+// NewAuditPlugin 创建审计插件
+func NewAuditPlugin(config *AuditConfig) *AuditPlugin {
+	return newAuditPlugin(config, "")
+}
+
+// newAuditPlugin 创建审计插件，tenantID为连接所属的租户
+func newAuditPlugin(config *AuditConfig, tenantID string) *AuditPlugin {
+	defaultConfig := NewDefaultAuditConfig()
+	if config == nil {
+		config = defaultConfig
+	} else {
+		merged := *config
+		if merged.Table == "" {
+			merged.Table = defaultConfig.Table
+		}
+		if merged.CreatedByField == "" {
+			merged.CreatedByField = defaultConfig.CreatedByField
+		}
+		if merged.UpdatedByField == "" {
+			merged.UpdatedByField = defaultConfig.UpdatedByField
+		}
+		config = &merged
+	}
+
+	return &AuditPlugin{config: config, tenantID: tenantID}
+}
+
+// Name 实现gorm.Plugin接口
+func (p *AuditPlugin) Name() string {
+	return "tenant:audit"
+}
+
+// Initialize 实现gorm.Plugin接口，注册审计回调
+func (p *AuditPlugin) Initialize(db *gorm.DB) error {
+	callbacks := []error{
+		db.Callback().Create().Before("gorm:create").Register("audit:before_create", p.beforeCreate),
+		db.Callback().Create().After("gorm:create").Register("audit:after_create", p.afterCreate),
+		db.Callback().Update().After("tenant:update").Before("gorm:update").Register("audit:before_update", p.beforeUpdate),
+		db.Callback().Update().After("gorm:update").Register("audit:after_update", p.afterUpdate),
+		db.Callback().Delete().After("tenant:delete").Before("gorm:delete").Register("audit:before_delete", p.beforeDelete),
+		db.Callback().Delete().After("gorm:delete").Register("audit:after_delete", p.afterDelete),
+	}
+	for _, err := range callbacks {
+		if err != nil {
+			return fmt.Errorf("failed to register audit callback: %w", err)
+		}
+	}
+	return nil
+}
+
+// Migrate 创建变更历史表
+func (p *AuditPlugin) Migrate(db *gorm.DB) error {
+	if err := db.Table(p.config.Table).AutoMigrate(&AuditLog{}); err != nil {
+		return fmt.Errorf("failed to migrate audit table: %w", err)
+	}
+	return nil
+}
+
+// skip 检查语句是否需要审计，变更历史表、迁移记录表和租户迁移的语句不做审计
+func (p *AuditPlugin) skip(db *gorm.DB) bool {
+	if db.Error != nil || db.Statement.Schema == nil || isDataMove(db) {
+		return true
+	}
+	switch db.Statement.Table {
+	case p.config.Table, SchemaMigration{}.TableName(), SchemaMigrationLock{}.TableName():
+		return true
+	}
+	return false
+}
+
+// recordHistory 检查语句是否需要记录变更历史
+func (p *AuditPlugin) recordHistory(db *gorm.DB) bool {
+	if p.config.DisableHistory {
+		return false
+	}
+	for _, table := range p.config.SkipTables {
+		if table == db.Statement.Table {
+			return false
+		}
+	}
+	return true
+}
+
+// beforeCreate 填充创建人和更新人
+func (p *AuditPlugin) beforeCreate(db *gorm.DB) {
+	if p.skip(db) {
+		return
+	}
+
+	userID := tools.GetUserID(db.Statement.Context)
+	if userID == "" {
+		return
+	}
+
+	for _, name := range []string{p.config.CreatedByField, p.config.UpdatedByField} {
+		if field := db.Statement.Schema.LookUpField(name); field != nil {
+			_ = db.AddError(setEmptyField(db, field, db.Statement.ReflectValue, userID))
+		}
+	}
+}
+
+// afterCreate 记录新建记录的字段值
+func (p *AuditPlugin) afterCreate(db *gorm.DB) {
+	if p.skip(db) || db.RowsAffected == 0 || !p.recordHistory(db) {
+		return
+	}
+
+	var logs []*AuditLog
+	eachRecord(db.Statement.ReflectValue, func(record reflect.Value) {
+		if record.Type() != db.Statement.Schema.ModelType {
+			return
+		}
+		row := recordValues(db, record)
+		logs = append(logs, p.newLog(db, AuditActionCreate, primaryKeyString(db.Statement.Schema, row), nil, row))
+	})
+	p.writeLogs(db, logs)
+}
+
+// beforeUpdate 填充更新人，并保存更新前的数据
+func (p *AuditPlugin) beforeUpdate(db *gorm.DB) {
+	if p.skip(db) {
+		return
+	}
+
+	if userID := tools.GetUserID(db.Statement.Context); userID != "" {
+		if field := db.Statement.Schema.LookUpField(p.config.UpdatedByField); field != nil {
+			p.setUpdatedBy(db, field, userID)
+		}
+	}
+
+	if p.recordHistory(db) {
+		p.saveSnapshot(db)
+	}
+}
+
+// afterUpdate 对比更新前后的数据并记录差异
+func (p *AuditPlugin) afterUpdate(db *gorm.DB) {
+	if p.skip(db) || db.RowsAffected == 0 {
+		return
+	}
+
+	before, ok := p.loadSnapshot(db)
+	if !ok || len(before) == 0 {
+		return
+	}
+
+	after, err := p.queryRows(db, []clause.Expression{primaryKeyCondition(db.Statement.Schema, before)})
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+
+	afterByKey := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByKey[primaryKeyString(db.Statement.Schema, row)] = row
+	}
+
+	var logs []*AuditLog
+	for _, old := range before {
+		key := primaryKeyString(db.Statement.Schema, old)
+		changedBefore, changedAfter := diffRows(old, afterByKey[key])
+		if len(changedBefore) == 0 && len(changedAfter) == 0 {
+			continue
+		}
+		logs = append(logs, p.newLog(db, AuditActionUpdate, key, changedBefore, changedAfter))
+	}
+	p.writeLogs(db, logs)
+}
+
+// beforeDelete 保存删除前的数据
+func (p *AuditPlugin) beforeDelete(db *gorm.DB) {
+	if p.skip(db) || !p.recordHistory(db) {
+		return
+	}
+	p.saveSnapshot(db)
+}
+
+// afterDelete 记录被删除记录的字段值
+func (p *AuditPlugin) afterDelete(db *gorm.DB) {
+	if p.skip(db) || db.RowsAffected == 0 {
+		return
+	}
+
+	before, ok := p.loadSnapshot(db)
+	if !ok {
+		return
+	}
+
+	logs := make([]*AuditLog, 0, len(before))
+	for _, row := range before {
+		logs = append(logs, p.newLog(db, AuditActionDelete, primaryKeyString(db.Statement.Schema, row), row, nil))
+	}
+	p.writeLogs(db, logs)
+}
+
+// setUpdatedBy 将更新人加入更新内容
+func (p *AuditPlugin) setUpdatedBy(db *gorm.DB, field *schema.Field, userID string) {
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		_, byName := dest[field.Name]
+		_, byDBName := dest[field.DBName]
+		if !byName && !byDBName {
+			dest[field.DBName] = userID
+		}
+	default:
+		value := reflect.Indirect(reflect.ValueOf(dest))
+		if value.Kind() != reflect.Struct || value.Type() != db.Statement.Schema.ModelType || !value.CanAddr() {
+			return
+		}
+		if err := field.Set(db.Statement.Context, value, userID); err != nil {
+			_ = db.AddError(err)
+			return
+		}
+	}
+
+	// 指定了更新字段时需要包含更新人
+	if selects := db.Statement.Selects; len(selects) > 0 && selects[0] != "*" {
+		db.Statement.Selects = append(selects, field.DBName)
+	}
+}
+
+// saveSnapshot 查询并保存将被修改的记录
+func (p *AuditPlugin) saveSnapshot(db *gorm.DB) {
+	conditions := snapshotConditions(db)
+	if len(conditions) == 0 && !db.AllowGlobalUpdate {
+		// 没有条件的更新和删除会被GORM拒绝
+		return
+	}
+
+	rows, err := p.queryRows(db, conditions)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	db.InstanceSet(auditSnapshotKey, rows)
+}
+
+// loadSnapshot 获取更新或删除前保存的记录
+func (p *AuditPlugin) loadSnapshot(db *gorm.DB) ([]map[string]interface{}, bool) {
+	value, ok := db.InstanceGet(auditSnapshotKey)
+	if !ok {
+		return nil, false
+	}
+	rows, ok := value.([]map[string]interface{})
+	return rows, ok
+}
+
+// queryRows 在主库上按条件查询模型对应的记录
+func (p *AuditPlugin) queryRows(db *gorm.DB, conditions []clause.Expression) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	tx := UsePrimary(db.Session(&gorm.Session{NewDB: true, SkipHooks: true})).
+		Model(reflect.New(db.Statement.Schema.ModelType).Interface()).
+		Table(db.Statement.Table)
+	if len(conditions) > 0 {
+		tx = tx.Clauses(clause.Where{Exprs: conditions})
+	}
+	if err := tx.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query audit snapshot: %w", err)
+	}
+	return rows, nil
+}
+
+// newLog 创建变更历史记录
+func (p *AuditPlugin) newLog(db *gorm.DB, action, primaryKey string, before, after map[string]interface{}) *AuditLog {
+	ctx := db.Statement.Context
+	tenantID := p.tenantID
+	if tenantID == "" {
+		tenantID, _ = GetTenantFromContext(ctx)
+	}
+
+	return &AuditLog{
+		Table:      db.Statement.Table,
+		PrimaryKey: primaryKey,
+		Action:     action,
+		Before:     marshalAuditValues(before),
+		After:      marshalAuditValues(after),
+		TenantID:   tenantID,
+		UserID:     tools.GetUserID(ctx),
+		TraceID:    tools.GetTraceID(ctx),
+	}
+}
+
+// writeLogs 写入变更历史，语句在事务中执行时使用同一事务
+func (p *AuditPlugin) writeLogs(db *gorm.DB, logs []*AuditLog) {
+	if len(logs) == 0 {
+		return
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	if err := tx.Table(p.config.Table).Create(&logs).Error; err != nil {
+		_ = db.AddError(fmt.Errorf("failed to write audit log: %w", err))
+	}
+}
+
+// setEmptyField 为记录中值为空的字段设置值，支持批量创建
+func setEmptyField(db *gorm.DB, field *schema.Field, value reflect.Value, fieldValue interface{}) error {
+	var err error
+	eachRecord(value, func(record reflect.Value) {
+		if err != nil || record.Type() != field.Schema.ModelType || !record.CanAddr() {
+			return
+		}
+		if _, isZero := field.ValueOf(db.Statement.Context, record); isZero {
+			err = field.Set(db.Statement.Context, record, fieldValue)
+		}
+	})
+	return err
+}
+
+// eachRecord 遍历结构体或切片中的每条记录
+func eachRecord(value reflect.Value, fn func(record reflect.Value)) {
+	value = reflect.Indirect(value)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			eachRecord(value.Index(i), fn)
+		}
+	case reflect.Struct:
+		fn(value)
+	}
+}
+
+// recordValues 获取记录中所有数据库字段的值
+func recordValues(db *gorm.DB, record reflect.Value) map[string]interface{} {
+	values := make(map[string]interface{}, len(db.Statement.Schema.DBNames))
+	for _, name := range db.Statement.Schema.DBNames {
+		field := db.Statement.Schema.FieldsByDBName[name]
+		values[name], _ = field.ValueOf(db.Statement.Context, record)
+	}
+	return values
+}
+
+// snapshotConditions 获取更新或删除语句的过滤条件，包括模型和目标中的主键
+func snapshotConditions(db *gorm.DB) []clause.Expression {
+	var conditions []clause.Expression
+	if c, ok := db.Statement.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			conditions = append(conditions, where.Exprs...)
+		}
+	}
+
+	values := []reflect.Value{db.Statement.ReflectValue}
+	if db.Statement.Model != nil {
+		values = append(values, reflect.ValueOf(db.Statement.Model))
+	}
+	for _, value := range values {
+		value = reflect.Indirect(value)
+		if !value.IsValid() || (value.Kind() == reflect.Struct && value.Type() != db.Statement.Schema.ModelType) {
+			continue
+		}
+
+		_, queryValues := schema.GetIdentityFieldValuesMap(db.Statement.Context, value, db.Statement.Schema.PrimaryFields)
+		if len(queryValues) > 0 {
+			column, values := schema.ToQueryValues(clause.CurrentTable, db.Statement.Schema.PrimaryFieldDBNames, queryValues)
+			conditions = append(conditions, clause.IN{Column: column, Values: values})
+			break
+		}
+	}
+	return conditions
+}
+
+// primaryKeyCondition 按查询结果的主键生成过滤条件
+func primaryKeyCondition(s *schema.Schema, rows []map[string]interface{}) clause.Expression {
+	queryValues := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		values := make([]interface{}, 0, len(s.PrimaryFieldDBNames))
+		for _, name := range s.PrimaryFieldDBNames {
+			values = append(values, row[name])
+		}
+		queryValues = append(queryValues, values)
+	}
+
+	column, values := schema.ToQueryValues(clause.CurrentTable, s.PrimaryFieldDBNames, queryValues)
+	return clause.IN{Column: column, Values: values}
+}
+
+// primaryKeyString 将主键值拼接为字符串，复合主键以逗号分隔
+func primaryKeyString(s *schema.Schema, row map[string]interface{}) string {
+	keys := make([]string, 0, len(s.PrimaryFieldDBNames))
+	for _, name := range s.PrimaryFieldDBNames {
+		keys = append(keys, fmt.Sprint(row[name]))
+	}
+	return strings.Join(keys, ",")
+}
+
+// diffRows 对比更新前后的记录，返回发生变化的字段
+func diffRows(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	changedBefore := make(map[string]interface{})
+	changedAfter := make(map[string]interface{})
+	for name, old := range before {
+		value := after[name]
+		if !reflect.DeepEqual(old, value) {
+			changedBefore[name] = old
+			changedAfter[name] = value
+		}
+	}
+	return changedBefore, changedAfter
+}
+
+// marshalAuditValues 将字段值序列化为JSON，空值返回空字符串
+func marshalAuditValues(values map[string]interface{}) string {
+	if values == nil {
+		return ""
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Sprintf("%v", values)
+	}
+	return string(data)
+}
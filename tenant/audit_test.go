@@ -0,0 +1,136 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/onebids/onecommon/consts"
+	"github.com/onebids/onecommon/tools"
+	"gorm.io/gorm"
+)
+
+type testAuditDoc struct {
+	ID        uint   `gorm:"primarykey"`
+	Title     string `gorm:"size:100"`
+	TenantID  string `gorm:"size:50;index"`
+	CreatedBy string `gorm:"size:64"`
+	UpdatedBy string `gorm:"size:64"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// auditContext 创建带有用户和追踪ID的上下文
+func auditContext(ctx context.Context, userID string) context.Context {
+	return tools.WithTraceID(tools.SetCtxValue(ctx, consts.UserID, userID), "trace-1")
+}
+
+// runAuditScenario 依次创建、更新、删除一条记录，返回按顺序写入的变更历史
+func runAuditScenario(t *testing.T, db *gorm.DB, ctx context.Context) []AuditLog {
+	t.Helper()
+
+	doc := testAuditDoc{Title: "v1"}
+	if err := db.WithContext(auditContext(ctx, "alice")).Create(&doc).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if doc.CreatedBy != "alice" || doc.UpdatedBy != "alice" {
+		t.Errorf("Create() by = %v/%v, want %v", doc.CreatedBy, doc.UpdatedBy, "alice")
+	}
+
+	if err := db.WithContext(auditContext(ctx, "bob")).Model(&doc).Update("title", "v2").Error; err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	var updated testAuditDoc
+	if err := db.WithContext(ctx).First(&updated, doc.ID).Error; err != nil {
+		t.Fatalf("First() error = %v", err)
+	}
+	if updated.UpdatedBy != "bob" || updated.CreatedBy != "alice" {
+		t.Errorf("Update() by = %v/%v, want %v/%v", updated.CreatedBy, updated.UpdatedBy, "alice", "bob")
+	}
+
+	if err := db.WithContext(auditContext(ctx, "carol")).Delete(&doc).Error; err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	var logs []AuditLog
+	if err := db.WithContext(ctx).Table("audit_logs").Order("id").Find(&logs).Error; err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(logs) != 3 {
+		t.Fatalf("audit logs = %v, want %v", len(logs), 3)
+	}
+
+	wants := []struct {
+		action string
+		userID string
+	}{
+		{AuditActionCreate, "alice"},
+		{AuditActionUpdate, "bob"},
+		{AuditActionDelete, "carol"},
+	}
+	for i, want := range wants {
+		if logs[i].Action != want.action || logs[i].UserID != want.userID {
+			t.Errorf("audit log %d = %v/%v, want %v/%v", i, logs[i].Action, logs[i].UserID, want.action, want.userID)
+		}
+		if logs[i].Table != "test_audit_docs" || logs[i].TraceID != "trace-1" {
+			t.Errorf("audit log %d table/trace = %v/%v", i, logs[i].Table, logs[i].TraceID)
+		}
+	}
+
+	var before, after map[string]interface{}
+	if err := json.Unmarshal([]byte(logs[1].Before), &before); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if err := json.Unmarshal([]byte(logs[1].After), &after); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if before["title"] != "v1" || after["title"] != "v2" || after["updated_by"] != "bob" {
+		t.Errorf("update diff = %v -> %v", before, after)
+	}
+	if _, ok := after["created_by"]; ok {
+		t.Errorf("update diff contains unchanged field created_by")
+	}
+	return logs
+}
+
+func TestAuditPlugin_FieldDBManager(t *testing.T) {
+	manager := newTestFieldDBManager(t, func(config *FieldDBConfig) {
+		config.Audit = NewDefaultAuditConfig()
+		config.MigrateFunc = func(db *gorm.DB) error {
+			return db.AutoMigrate(&testAuditDoc{})
+		}
+	})
+
+	ctx := WithTenant(context.Background(), "tenant-a")
+	db, err := manager.GetDB(ctx)
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+
+	for i, log := range runAuditScenario(t, db, ctx) {
+		if log.TenantID != "tenant-a" {
+			t.Errorf("audit log %d TenantID = %v, want %v", i, log.TenantID, "tenant-a")
+		}
+	}
+}
+
+func TestAuditPlugin_TenantDBManager(t *testing.T) {
+	config := NewDefaultDBConfig()
+	config.Audit = NewDefaultAuditConfig()
+	config.MigrateFunc = func(db *gorm.DB) error {
+		return db.AutoMigrate(&testAuditDoc{})
+	}
+	manager := newTestTenantDBManager(t, config)
+
+	db, err := manager.GetDB("tenant1")
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+
+	for i, log := range runAuditScenario(t, db, context.Background()) {
+		if log.TenantID != "tenant1" {
+			t.Errorf("audit log %d TenantID = %v, want %v", i, log.TenantID, "tenant1")
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package tenant
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// tenantDBEntry 租户连接池缓存项
+type tenantDBEntry struct {
+	tenantID string
+	db       *gorm.DB
+	lastUsed time.Time
+}
+
+// retiredDBs 已移出缓存、等待宽限期结束后关闭的连接池
+type retiredDBs struct {
+	mutex  sync.Mutex
+	timers map[*gorm.DB]*time.Timer
+}
+
+// CacheStats 租户连接池缓存统计
+type CacheStats struct {
+	// 命中次数
+	Hits uint64
+	// 未命中次数（需要新建连接池）
+	Misses uint64
+	// 被淘汰并关闭的连接池数量
+	Evictions uint64
+	// 当前打开的连接池数量
+	Open int
+}
+
+// cacheCounters 缓存计数器
+type cacheCounters struct {
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// lookupDB 查找已打开的租户连接池，命中时移到链表头部并刷新最近使用时间
+// 调用方需持有读锁或写锁。链表的增删只在写锁下进行，
+// 命中时只调整顺序，由lruMutex保护，避免每次命中都获取写锁
+func (m *TenantDBManager) lookupDB(tenantID string) (*gorm.DB, bool) {
+	elem, ok := m.dbs[tenantID]
+	if !ok {
+		return nil, false
+	}
+
+	m.lruMutex.Lock()
+	defer m.lruMutex.Unlock()
+	m.lru.MoveToFront(elem)
+	entry := elem.Value.(*tenantDBEntry)
+	entry.lastUsed = time.Now()
+	return entry.db, true
+}
+
+// entries 按最近使用顺序获取所有缓存项
+// 调用方需持有读锁
+func (m *TenantDBManager) entries() []*tenantDBEntry {
+	m.lruMutex.Lock()
+	defer m.lruMutex.Unlock()
+
+	entries := make([]*tenantDBEntry, 0, m.lru.Len())
+	for elem := m.lru.Front(); elem != nil; elem = elem.Next() {
+		entries = append(entries, elem.Value.(*tenantDBEntry))
+	}
+	return entries
+}
+
+// storeDB 保存租户连接池，并在超过上限时淘汰最久未使用的租户
+// 调用方需持有写锁，返回的被淘汰连接池需在释放锁后关闭
+func (m *TenantDBManager) storeDB(tenantID string, db *gorm.DB) []*tenantDBEntry {
+	if elem, ok := m.dbs[tenantID]; ok {
+		m.lru.MoveToFront(elem)
+		entry := elem.Value.(*tenantDBEntry)
+		entry.db = db
+		entry.lastUsed = time.Now()
+		return nil
+	}
+
+	m.dbs[tenantID] = m.lru.PushFront(&tenantDBEntry{tenantID: tenantID, db: db, lastUsed: time.Now()})
+
+	if m.config.MaxOpenTenants <= 0 {
+		return nil
+	}
+
+	var evicted []*tenantDBEntry
+	for m.lru.Len() > m.config.MaxOpenTenants {
+		elem := m.leastRecentlyUsed(tenantID)
+		if elem == nil {
+			break
+		}
+		evicted = append(evicted, m.removeEntry(elem))
+	}
+	return evicted
+}
+
+// leastRecentlyUsed 从链表尾部查找最久未使用的租户连接池，默认库和except不参与淘汰
+// 调用方需持有写锁
+func (m *TenantDBManager) leastRecentlyUsed(except string) *list.Element {
+	for elem := m.lru.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*tenantDBEntry)
+		if entry.tenantID != "" && entry.tenantID != except {
+			return elem
+		}
+	}
+	return nil
+}
+
+// removeEntry 从缓存中移除租户连接池
+// 调用方需持有写锁
+func (m *TenantDBManager) removeEntry(elem *list.Element) *tenantDBEntry {
+	entry := m.lru.Remove(elem).(*tenantDBEntry)
+	delete(m.dbs, entry.tenantID)
+	return entry
+}
+
+// collectIdle 收集空闲超时的租户连接池
+// 调用方需持有写锁
+func (m *TenantDBManager) collectIdle(now time.Time) []*tenantDBEntry {
+	var evicted []*tenantDBEntry
+	for elem := m.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		entry := elem.Value.(*tenantDBEntry)
+		// 链表按最近使用排序，遇到未超时的缓存项即可停止
+		if now.Sub(entry.lastUsed) < m.config.TenantIdleTimeout {
+			break
+		}
+		if entry.tenantID != "" {
+			evicted = append(evicted, m.removeEntry(elem))
+		}
+		elem = prev
+	}
+	return evicted
+}
+
+// closeEvicted 在宽限期后关闭被淘汰的连接池
+func (m *TenantDBManager) closeEvicted(entries []*tenantDBEntry) {
+	for _, entry := range entries {
+		m.counters.evictions.Add(1)
+		m.retireDB(entry.db)
+	}
+}
+
+// retireDB 在EvictGracePeriod之后关闭已移出缓存的连接池
+// 调用方可能仍持有GetDB返回的连接并在执行查询，立即关闭会使查询失败("sql: database is closed")。
+// GetDB返回的*gorm.DB没有释放接口，无法可靠地引用计数，因此采用宽限期：
+// 宽限期内旧连接仍可使用，新的GetDB会重新打开连接池
+func (m *TenantDBManager) retireDB(db *gorm.DB) {
+	if m.config.EvictGracePeriod <= 0 {
+		closeDB(db)
+		return
+	}
+
+	m.retired.mutex.Lock()
+	defer m.retired.mutex.Unlock()
+	if m.retired.timers == nil {
+		m.retired.timers = make(map[*gorm.DB]*time.Timer)
+	}
+	m.retired.timers[db] = time.AfterFunc(m.config.EvictGracePeriod, func() {
+		m.retired.mutex.Lock()
+		_, ok := m.retired.timers[db]
+		delete(m.retired.timers, db)
+		m.retired.mutex.Unlock()
+
+		// CloseAll已关闭时不再重复关闭
+		if ok {
+			closeDB(db)
+		}
+	})
+}
+
+// closeRetired 立即关闭所有等待宽限期结束的连接池
+func (m *TenantDBManager) closeRetired() {
+	m.retired.mutex.Lock()
+	timers := m.retired.timers
+	m.retired.timers = nil
+	m.retired.mutex.Unlock()
+
+	for db, timer := range timers {
+		timer.Stop()
+		closeDB(db)
+	}
+}
+
+// EvictIdle 立即关闭所有空闲超时的租户连接池
+// 未配置TenantIdleTimeout时不做任何操作
+func (m *TenantDBManager) EvictIdle() int {
+	if m.config.TenantIdleTimeout <= 0 {
+		return 0
+	}
+
+	m.mutex.Lock()
+	evicted := m.collectIdle(time.Now())
+	m.mutex.Unlock()
+
+	m.closeEvicted(evicted)
+	return len(evicted)
+}
+
+// runEvictor 定期淘汰空闲的租户连接池
+func (m *TenantDBManager) runEvictor(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.EvictIdle()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// CacheStats 获取租户连接池缓存统计
+func (m *TenantDBManager) CacheStats() CacheStats {
+	m.mutex.RLock()
+	open := len(m.dbs)
+	m.mutex.RUnlock()
+
+	return CacheStats{
+		Hits:      m.counters.hits.Load(),
+		Misses:    m.counters.misses.Load(),
+		Evictions: m.counters.evictions.Load(),
+		Open:      open,
+	}
+}
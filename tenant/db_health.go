@@ -0,0 +1,281 @@
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/onebids/onecommon/mtl"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+const (
+	// SharedDBLabel 字段级隔离共享库在健康检查和监控指标中使用的租户标识
+	SharedDBLabel = "_shared"
+
+	// otherTenantsLabel 超出标签数量上限的租户合并使用的标识
+	otherTenantsLabel = "_other"
+)
+
+// PingResult 数据库健康检查结果
+type PingResult struct {
+	TenantID string
+	Healthy  bool
+	Latency  time.Duration
+	Err      error
+}
+
+// pingDB 检查数据库连接是否可用
+func pingDB(ctx context.Context, tenantID string, db *gorm.DB) PingResult {
+	result := PingResult{TenantID: tenantID}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	start := time.Now()
+	result.Err = sqlDB.PingContext(ctx)
+	result.Latency = time.Since(start)
+	result.Healthy = result.Err == nil
+	return result
+}
+
+// dbStats 获取数据库连接池统计，注册了只读副本时合计主库和副本
+func dbStats(db *gorm.DB) sql.DBStats {
+	var total sql.DBStats
+	if resolver, ok := getResolver(db); ok {
+		_ = resolver.Call(func(connPool gorm.ConnPool) error {
+			if sqlDB, ok := connPool.(*sql.DB); ok {
+				addDBStats(&total, sqlDB.Stats())
+			}
+			return nil
+		})
+		return total
+	}
+
+	if sqlDB, err := db.DB(); err == nil {
+		total = sqlDB.Stats()
+	}
+	return total
+}
+
+// addDBStats 累加连接池统计
+func addDBStats(total *sql.DBStats, stats sql.DBStats) {
+	total.OpenConnections += stats.OpenConnections
+	total.InUse += stats.InUse
+	total.Idle += stats.Idle
+	total.WaitCount += stats.WaitCount
+	total.WaitDuration += stats.WaitDuration
+}
+
+// PingAll 检查所有已打开的租户连接池，返回每个租户的状态和延迟
+func (m *TenantDBManager) PingAll(ctx context.Context) map[string]PingResult {
+	m.mutex.RLock()
+	entries := m.entries()
+	m.mutex.RUnlock()
+
+	results := make(map[string]PingResult, len(entries))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		wg.Add(1)
+		go func(entry *tenantDBEntry) {
+			defer wg.Done()
+			result := pingDB(ctx, entry.tenantID, entry.db)
+
+			mutex.Lock()
+			results[entry.tenantID] = result
+			mutex.Unlock()
+		}(entry)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// PingAll 检查共享数据库连接，结果以SharedDBLabel为键
+func (m *FieldDBManager) PingAll(ctx context.Context) map[string]PingResult {
+	m.mutex.RLock()
+	db := m.db
+	m.mutex.RUnlock()
+
+	result := PingResult{TenantID: SharedDBLabel}
+	if db == nil {
+		result.Err = fmt.Errorf("database not connected, call Connect() first")
+	} else {
+		result = pingDB(ctx, SharedDBLabel, db)
+	}
+	return map[string]PingResult{SharedDBLabel: result}
+}
+
+// tenantDBStats 租户连接池统计
+type tenantDBStats struct {
+	tenantID string
+	stats    sql.DBStats
+}
+
+// poolStats 获取所有已打开租户的连接池统计，按最近使用排序
+func (m *TenantDBManager) poolStats() []tenantDBStats {
+	m.mutex.RLock()
+	entries := m.entries()
+	m.mutex.RUnlock()
+
+	stats := make([]tenantDBStats, 0, len(entries))
+	for _, entry := range entries {
+		stats = append(stats, tenantDBStats{tenantID: entry.tenantID, stats: dbStats(entry.db)})
+	}
+	return stats
+}
+
+// poolStats 获取共享数据库的连接池统计
+func (m *FieldDBManager) poolStats() []tenantDBStats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.db == nil {
+		return nil
+	}
+	return []tenantDBStats{{tenantID: SharedDBLabel, stats: dbStats(m.db)}}
+}
+
+// tenantLabels 为租户分配指标标签，先到先得，超过上限的租户合并到_other
+// 已分配标签的租户始终使用自己的标签，累计指标不会在租户标签和_other之间切换而出现回退
+type tenantLabels struct {
+	mutex      sync.Mutex
+	tenants    map[string]struct{}
+	maxTenants int
+}
+
+// newTenantLabels 创建租户标签分配器，maxTenants不大于0时不限制
+func newTenantLabels(maxTenants int) *tenantLabels {
+	return &tenantLabels{
+		tenants:    make(map[string]struct{}),
+		maxTenants: maxTenants,
+	}
+}
+
+// label 获取租户的指标标签，空租户ID不占用名额
+func (l *tenantLabels) label(tenantID string) string {
+	if tenantID == "" {
+		return tenantID
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, ok := l.tenants[tenantID]; ok {
+		return tenantID
+	}
+	if l.maxTenants > 0 && len(l.tenants) >= l.maxTenants {
+		return otherTenantsLabel
+	}
+	l.tenants[tenantID] = struct{}{}
+	return tenantID
+}
+
+// dbStatsCollector 连接池统计采集器，在抓取时读取sql.DBStats
+type dbStatsCollector struct {
+	stats  func() []tenantDBStats
+	labels *tenantLabels
+
+	openConnections *prometheus.Desc
+	inUse           *prometheus.Desc
+	idle            *prometheus.Desc
+	waitCount       *prometheus.Desc
+	waitDuration    *prometheus.Desc
+}
+
+// newDBStatsCollector 创建连接池统计采集器
+// 超过maxTenants的租户合并到_other标签，防止标签基数过大
+func newDBStatsCollector(name string, stats func() []tenantDBStats, maxTenants int) *dbStatsCollector {
+	labels := []string{"tenant"}
+	constLabels := prometheus.Labels{"manager": name}
+	return &dbStatsCollector{
+		stats:  stats,
+		labels: newTenantLabels(maxTenants),
+		openConnections: prometheus.NewDesc("tenant_db_open_connections",
+			"Number of established connections both in use and idle.", labels, constLabels),
+		inUse: prometheus.NewDesc("tenant_db_in_use_connections",
+			"Number of connections currently in use.", labels, constLabels),
+		idle: prometheus.NewDesc("tenant_db_idle_connections",
+			"Number of idle connections.", labels, constLabels),
+		waitCount: prometheus.NewDesc("tenant_db_wait_count_total",
+			"Total number of connections waited for.", labels, constLabels),
+		waitDuration: prometheus.NewDesc("tenant_db_wait_duration_seconds_total",
+			"Total time blocked waiting for a new connection.", labels, constLabels),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.openConnections
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	var other sql.DBStats
+	hasOther := false
+	for _, item := range c.stats() {
+		label := c.labels.label(item.tenantID)
+		if label == otherTenantsLabel {
+			addDBStats(&other, item.stats)
+			hasOther = true
+			continue
+		}
+		c.collect(ch, label, item.stats)
+	}
+	if hasOther {
+		c.collect(ch, otherTenantsLabel, other)
+	}
+}
+
+// collect 输出单个租户的连接池指标
+func (c *dbStatsCollector) collect(ch chan<- prometheus.Metric, tenantID string, stats sql.DBStats) {
+	ch <- prometheus.MustNewConstMetric(c.openConnections, prometheus.GaugeValue, float64(stats.OpenConnections), tenantID)
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse), tenantID)
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle), tenantID)
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount), tenantID)
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), tenantID)
+}
+
+// metricsRegisterer 获取指标注册器，未指定时使用mtl.Registry
+func metricsRegisterer(registerer prometheus.Registerer) (prometheus.Registerer, error) {
+	if registerer != nil {
+		return registerer, nil
+	}
+	if mtl.Registry == nil {
+		return nil, fmt.Errorf("metrics registry not initialized, call mtl.InitMetric first")
+	}
+	return mtl.Registry, nil
+}
+
+// RegisterMetrics 将所有租户连接池的统计注册为Prometheus指标
+// registerer为nil时使用mtl.Registry
+func (m *TenantDBManager) RegisterMetrics(registerer prometheus.Registerer) error {
+	registerer, err := metricsRegisterer(registerer)
+	if err != nil {
+		return err
+	}
+	return registerer.Register(newDBStatsCollector("tenant", m.poolStats, m.config.MaxMetricTenants))
+}
+
+// RegisterMetrics 将共享数据库连接池的统计和跨租户访问次数注册为Prometheus指标
+// registerer为nil时使用mtl.Registry
+func (m *FieldDBManager) RegisterMetrics(registerer prometheus.Registerer) error {
+	registerer, err := metricsRegisterer(registerer)
+	if err != nil {
+		return err
+	}
+	if err := registerer.Register(newDBStatsCollector("field", m.poolStats, 0)); err != nil {
+		return err
+	}
+	return registerer.Register(m.systemScopes)
+}
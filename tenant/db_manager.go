@@ -1,25 +1,32 @@
 package tenant
 
 import (
-	"database/sql"
+	"container/list"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"strings"
 	"sync"
 	"time"
 
-	"gorm.io/driver/mysql"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	"gorm.io/plugin/opentelemetry/tracing"
 )
 
 // MigrateFunc 定义数据库迁移函数类型
+//
+// Deprecated: MigrateFunc在每次首次连接时执行且不记录执行情况，请使用Migrator
 type MigrateFunc func(db *gorm.DB) error
 
 // DBConfig 数据库管理器配置
 type DBConfig struct {
+	// SQL方言
+	// 默认值: MySQL
+	Dialect Dialect
+
 	// DSN连接字符串或模板
 	// 对于多租户情况，可以是带有%s占位符的模板，如：
 	// "user:pass@tcp(host:port)/%s?charset=utf8mb4&parseTime=True&loc=Local"
@@ -51,29 +58,105 @@ type DBConfig struct {
 	// 默认值: nil (不执行迁移)
 	MigrateFunc MigrateFunc
 
+	// 版本化迁移引擎，租户库首次连接时执行未执行的迁移
+	// 默认值: nil (不执行版本化迁移)
+	Migrator *Migrator
+
 	// 是否自动创建数据库
 	// 默认值: false
 	AutoCreateDatabase bool
 
-	// 数据库字符集
+	// 数据库字符集，PostgreSQL仅识别utf8系列字符集，SQLite忽略该配置
 	// 默认值: utf8mb4
 	DefaultCharset string
 
-	// 数据库排序规则
+	// 数据库排序规则，仅MySQL使用
 	// 默认值: utf8mb4_general_ci
 	DefaultCollation string
+
+	// 最多同时打开的租户连接池数量，超出时关闭最久未使用的租户连接池
+	// 默认库不计入淘汰
+	// 默认值: 0 (不限制)
+	MaxOpenTenants int
+
+	// 租户连接池空闲超时时间，超过该时间未被访问的租户连接池将被关闭，
+	// 下次GetDB时自动重新打开
+	// 默认值: 0 (不淘汰)
+	TenantIdleTimeout time.Duration
+
+	// 空闲连接池检查间隔
+	// 默认值: 1 * time.Minute
+	EvictInterval time.Duration
+
+	// 连接池被淘汰或DSN变化后延迟关闭的时间，期间已获取该连接的调用方仍可继续执行查询
+	// 小于0时立即关闭
+	// 默认值: 30 * time.Second
+	EvictGracePeriod time.Duration
+
+	// 连接创建失败后的初始退避时间，之后每次失败翻倍
+	// 默认值: 1 * time.Second
+	RetryBackoff time.Duration
+
+	// 连接创建失败后的最大退避时间
+	// 默认值: 30 * time.Second
+	MaxRetryBackoff time.Duration
+
+	// 租户的只读副本DSN，键为租户ID
+	// 配置后查询路由到副本，写操作和事务使用主库
+	// 默认值: 空map
+	TenantReplicaDSNs map[string][]string
+
+	// 只读副本DSN模板列表，每个模板带有%s占位符
+	// 适用于未在TenantReplicaDSNs中配置副本的租户
+	// 默认值: nil (不使用副本)
+	ReplicaDSNTemplates []string
+
+	// 监控指标中单独展示的租户数量上限，其余租户合并为_other，防止标签基数过大
+	// 默认值: 100
+	MaxMetricTenants int
+
+	// 是否允许SyncTenants使用空的租户列表，移除所有由租户来源添加的租户
+	// 租户来源读取异常时可能返回空列表，默认拒绝以免下线全部租户
+	// 默认值: false
+	AllowEmptyTenantSync bool
+
+	// 默认连接池配置，适用于所有租户
+	// 默认值: 见NewDefaultPoolConfig函数
+	Pool *PoolConfig
+
+	// 租户特定的连接池配置，键为租户ID
+	// 只需设置需要覆盖的字段，其余字段沿用Pool
+	// 默认值: 空map
+	TenantPools map[string]*PoolConfig
+
+	// 审计配置，设置后租户库自动填充创建人、更新人并记录变更历史
+	// 默认值: nil (不启用审计)
+	Audit *AuditConfig
+
+	// 租户行数配额，设置后租户库创建记录前检查配额
+	// 默认值: nil (不限制)
+	Quota *TenantQuota
 }
 
 // NewDefaultDBConfig 创建带有默认值的配置
 func NewDefaultDBConfig() *DBConfig {
 	return &DBConfig{
+		Dialect:            MySQL,
 		TenantDSNs:         make(map[string]string),
+		TenantReplicaDSNs:  make(map[string][]string),
 		EnableTracing:      true,
 		LogLevel:           logger.Error,
 		SlowThreshold:      200 * time.Millisecond,
 		AutoCreateDatabase: true,
 		DefaultCharset:     "utf8mb4",
 		DefaultCollation:   "utf8mb4_general_ci",
+		EvictInterval:      time.Minute,
+		EvictGracePeriod:   30 * time.Second,
+		RetryBackoff:       time.Second,
+		MaxRetryBackoff:    30 * time.Second,
+		MaxMetricTenants:   100,
+		Pool:               NewDefaultPoolConfig(),
+		TenantPools:        make(map[string]*PoolConfig),
 		DBConfig: &gorm.Config{
 			PrepareStmt:            true,
 			SkipDefaultTransaction: true,
@@ -91,10 +174,21 @@ func NewDefaultDBConfig() *DBConfig {
 
 // TenantDBManager 租户数据库管理器
 type TenantDBManager struct {
-	dbs           map[string]*gorm.DB
+	dbs           map[string]*list.Element
+	lru           *list.List
+	lruMutex      sync.Mutex
 	mutex         sync.RWMutex
 	config        *DBConfig
 	defaultConfig *gorm.Config
+	counters      cacheCounters
+	creating      singleflight.Group
+	failures      map[string]*createFailure
+	deprovisioned map[string]struct{}
+	generations   map[string]uint64
+	sourced       map[string]struct{}
+	retired       retiredDBs
+	stopEvictor   chan struct{}
+	stopOnce      sync.Once
 }
 
 // NewTenantDBManager 创建租户数据库管理器
@@ -106,11 +200,20 @@ func NewTenantDBManager(config *DBConfig) *TenantDBManager {
 		// 填充默认值
 		defaultConfig := NewDefaultDBConfig()
 
+		// 未指定方言时使用MySQL
+		if config.Dialect == nil {
+			config.Dialect = defaultConfig.Dialect
+		}
+
 		// 租户DSNs为nil时初始化
 		if config.TenantDSNs == nil {
 			config.TenantDSNs = make(map[string]string)
 		}
 
+		if config.TenantReplicaDSNs == nil {
+			config.TenantReplicaDSNs = make(map[string][]string)
+		}
+
 		// 设置默认字符集和排序规则
 		if config.DefaultCharset == "" {
 			config.DefaultCharset = defaultConfig.DefaultCharset
@@ -120,6 +223,35 @@ func NewTenantDBManager(config *DBConfig) *TenantDBManager {
 			config.DefaultCollation = defaultConfig.DefaultCollation
 		}
 
+		if config.EvictInterval <= 0 {
+			config.EvictInterval = defaultConfig.EvictInterval
+		}
+
+		if config.EvictGracePeriod == 0 {
+			config.EvictGracePeriod = defaultConfig.EvictGracePeriod
+		}
+
+		if config.RetryBackoff <= 0 {
+			config.RetryBackoff = defaultConfig.RetryBackoff
+		}
+
+		if config.MaxRetryBackoff <= 0 {
+			config.MaxRetryBackoff = defaultConfig.MaxRetryBackoff
+		}
+
+		if config.MaxMetricTenants <= 0 {
+			config.MaxMetricTenants = defaultConfig.MaxMetricTenants
+		}
+
+		// 连接池配置为nil时使用默认值
+		if config.Pool == nil {
+			config.Pool = defaultConfig.Pool
+		}
+
+		if config.TenantPools == nil {
+			config.TenantPools = make(map[string]*PoolConfig)
+		}
+
 		// 数据库配置为nil时使用默认值
 		if config.DBConfig == nil {
 			config.DBConfig = defaultConfig.DBConfig
@@ -148,29 +280,50 @@ func NewTenantDBManager(config *DBConfig) *TenantDBManager {
 		}
 	}
 
-	return &TenantDBManager{
-		dbs:           make(map[string]*gorm.DB),
+	manager := &TenantDBManager{
+		dbs:           make(map[string]*list.Element),
+		lru:           list.New(),
+		failures:      make(map[string]*createFailure),
+		deprovisioned: make(map[string]struct{}),
+		generations:   make(map[string]uint64),
+		sourced:       make(map[string]struct{}),
 		config:        config,
 		defaultConfig: config.DBConfig,
+		stopEvictor:   make(chan struct{}),
 	}
+
+	// 启动空闲连接池淘汰
+	if config.TenantIdleTimeout > 0 {
+		go manager.runEvictor(config.EvictInterval, manager.stopEvictor)
+	}
+
+	return manager
 }
 
 // GetDB 获取指定租户的数据库连接
 func (m *TenantDBManager) GetDB(tenantID string) (*gorm.DB, error) {
+	return m.GetDBContext(context.Background(), tenantID)
+}
+
+// GetDBContext 获取指定租户的数据库连接
+// 需要新建连接时，等待时间受ctx的截止时间控制
+func (m *TenantDBManager) GetDBContext(ctx context.Context, tenantID string) (*gorm.DB, error) {
 	if tenantID == "" {
 		return nil, fmt.Errorf("tenant ID cannot be empty")
 	}
 
 	m.mutex.RLock()
-	db, exists := m.dbs[tenantID]
+	db, exists := m.lookupDB(tenantID)
 	m.mutex.RUnlock()
 
 	if exists {
+		m.counters.hits.Add(1)
 		return db, nil
 	}
 
 	// 如果不存在，创建新连接
-	return m.createDB(tenantID)
+	m.counters.misses.Add(1)
+	return m.createDB(ctx, tenantID)
 }
 
 // GetDefaultDB 获取默认数据库连接
@@ -179,88 +332,172 @@ func (m *TenantDBManager) GetDefaultDB() (*gorm.DB, error) {
 	return m.GetDB("")
 }
 
-// extractDatabaseName 从DSN中提取数据库名称
-func extractDatabaseName(dsn string) string {
-	// 解析DSN格式: user:pass@tcp(host:port)/dbname?param=value
-	parts := strings.Split(dsn, "/")
-	if len(parts) < 2 {
-		return ""
+// createDB 创建租户数据库连接
+// 同一租户的并发调用共享同一次创建，其他租户不受影响
+// 迁移使用发起创建的调用方ctx中的值（如追踪信息），但不随其取消：
+// 创建结果由所有等待的调用方共享，且中断的DDL可能使数据库处于不一致状态
+func (m *TenantDBManager) createDB(ctx context.Context, tenantID string) (*gorm.DB, error) {
+	// 上次创建失败且仍在退避期内时直接返回
+	if err := m.checkBackoff(tenantID); err != nil {
+		return nil, err
 	}
 
-	// 处理查询参数
-	dbNameParts := strings.Split(parts[1], "?")
-	return dbNameParts[0]
+	ch := m.creating.DoChan(tenantID, func() (interface{}, error) {
+		return m.openDB(context.WithoutCancel(ctx), tenantID)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*gorm.DB), nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for database of tenant %s: %w", tenantID, ctx.Err())
+	}
 }
 
-// createDatabase 创建数据库
-func (m *TenantDBManager) createDatabase(dsn, dbName string) error {
-	// 创建一个不指定数据库的DSN
-	dsnWithoutDB := strings.Split(dsn, "/")[0] + "/"
+// resolveDSN 确定租户的DSN
+// 调用方需持有锁
+func (m *TenantDBManager) resolveDSN(tenantID string) (string, error) {
+	if _, ok := m.deprovisioned[tenantID]; ok {
+		return "", fmt.Errorf("tenant %s has been deprovisioned", tenantID)
+	}
 
-	// 连接到MySQL服务器（不指定数据库）
-	db, err := sql.Open("mysql", dsnWithoutDB)
+	if specificDSN, ok := m.config.TenantDSNs[tenantID]; ok {
+		// 使用预配置的租户特定DSN
+		return specificDSN, nil
+	}
+
+	if m.config.DSNTemplate != "" {
+		// 使用模板构建租户特定DSN
+		return fmt.Sprintf(m.config.DSNTemplate, tenantID), nil
+	}
+
+	return "", fmt.Errorf("no DSN configuration found for tenant: %s", tenantID)
+}
+
+// errTenantConfigChanged 连接期间租户配置发生变化
+var errTenantConfigChanged = errors.New("tenant configuration changed while connecting")
+
+// openDB 打开租户数据库连接，连接期间租户配置变化时使用新配置重新连接
+func (m *TenantDBManager) openDB(ctx context.Context, tenantID string) (*gorm.DB, error) {
+	for {
+		db, err := m.openDBOnce(ctx, tenantID)
+		if !errors.Is(err, errTenantConfigChanged) {
+			return db, err
+		}
+	}
+}
+
+// openDBOnce 打开租户数据库连接，执行迁移后存入缓存
+// 不持有管理器锁执行耗时操作
+func (m *TenantDBManager) openDBOnce(ctx context.Context, tenantID string) (db *gorm.DB, err error) {
+	m.mutex.Lock()
+	// 再次检查，防止重复创建
+	if db, exists := m.lookupDB(tenantID); exists {
+		m.mutex.Unlock()
+		return db, nil
+	}
+
+	// 确定DSN
+	dsn, err := m.resolveDSN(tenantID)
+	// 记录配置版本，存入缓存前确认连接期间DSN未被更新或移除
+	generation := m.generations[tenantID]
+	migrateFunc := m.config.MigrateFunc
+	migrator := m.config.Migrator
+	m.mutex.Unlock()
 	if err != nil {
-		return fmt.Errorf("failed to connect to MySQL server: %w", err)
+		return nil, err
 	}
-	defer db.Close()
 
-	// 创建数据库
-	createSQL := fmt.Sprintf(
-		"CREATE DATABASE IF NOT EXISTS `%s` CHARACTER SET %s COLLATE %s",
-		dbName,
-		m.config.DefaultCharset,
-		m.config.DefaultCollation,
-	)
+	defer func() {
+		if err == nil {
+			return
+		}
+		// 创建失败时释放已打开的连接，并记录失败以便退避
+		if db != nil {
+			closeDB(db)
+			db = nil
+		}
+		if !errors.Is(err, errTenantConfigChanged) {
+			m.recordFailure(tenantID, err)
+		}
+	}()
 
-	_, err = db.Exec(createSQL)
+	db, err = m.connect(tenantID, dsn, m.config.AutoCreateDatabase)
 	if err != nil {
-		return fmt.Errorf("failed to create database %s: %w", dbName, err)
+		return nil, err
 	}
 
-	return nil
-}
+	if err = m.migrate(ctx, tenantID, db, migrateFunc, migrator); err != nil {
+		return db, err
+	}
 
-// createDB 创建租户数据库连接
-func (m *TenantDBManager) createDB(tenantID string) (*gorm.DB, error) {
+	// 存储连接
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	if m.generations[tenantID] != generation {
+		m.mutex.Unlock()
+		return db, errTenantConfigChanged
+	}
+	delete(m.failures, tenantID)
+	evicted := m.storeDB(tenantID, db)
+	m.mutex.Unlock()
 
-	// 再次检查，防止并发创建
-	if db, exists := m.dbs[tenantID]; exists {
-		return db, nil
+	// 在释放锁后关闭被淘汰的连接池
+	m.closeEvicted(evicted)
+
+	return db, nil
+}
+
+// migrate 对租户库创建变更历史表并执行迁移，默认库不执行
+func (m *TenantDBManager) migrate(ctx context.Context, tenantID string, db *gorm.DB, migrateFunc MigrateFunc, migrator *Migrator) error {
+	if tenantID == "" {
+		return nil
 	}
 
-	// 确定DSN
-	var dsn string
+	// 迁移使用调用方的ctx，缓存的连接不携带ctx
+	migrateDB := db.WithContext(ctx)
 
-	if specificDSN, ok := m.config.TenantDSNs[tenantID]; ok {
-		// 使用预配置的租户特定DSN
-		dsn = specificDSN
-	} else if m.config.DSNTemplate != "" {
-		// 使用模板构建租户特定DSN
-		dsn = fmt.Sprintf(m.config.DSNTemplate, tenantID)
-	} else {
-		return nil, fmt.Errorf("no DSN configuration found for tenant: %s", tenantID)
+	// 创建变更历史表
+	if m.config.Audit != nil {
+		if err := newAuditPlugin(m.config.Audit, tenantID).Migrate(migrateDB); err != nil {
+			return fmt.Errorf("failed to migrate database for tenant %s: %w", tenantID, err)
+		}
 	}
 
-	// 尝试连接数据库
-	db, err := gorm.Open(mysql.Open(dsn), m.defaultConfig)
+	// 执行迁移
+	if migrateFunc != nil {
+		if err := migrateFunc(migrateDB); err != nil {
+			return fmt.Errorf("failed to migrate database for tenant %s: %w", tenantID, err)
+		}
+	}
 
-	// 如果连接失败且启用了自动创建数据库
-	if err != nil && m.config.AutoCreateDatabase {
-		// 提取数据库名称
-		dbName := extractDatabaseName(dsn)
-		if dbName == "" {
-			return nil, fmt.Errorf("failed to extract database name from DSN for tenant %s", tenantID)
+	// 执行版本化迁移
+	if migrator != nil {
+		if _, err := migrator.Up(ctx, db); err != nil {
+			return fmt.Errorf("failed to migrate database for tenant %s: %w", tenantID, err)
 		}
+	}
+	return nil
+}
 
+// connect 打开租户数据库连接并完成连接池和追踪设置，不执行迁移也不存入缓存
+func (m *TenantDBManager) connect(tenantID, dsn string, autoCreate bool) (*gorm.DB, error) {
+	dialect := m.config.Dialect
+
+	// 尝试连接数据库
+	db, err := gorm.Open(dialect.Open(dsn), m.defaultConfig)
+
+	// 如果连接失败且启用了自动创建数据库
+	if err != nil && autoCreate {
 		// 创建数据库
-		if createErr := m.createDatabase(dsn, dbName); createErr != nil {
+		if createErr := dialect.CreateDatabase(dsn, m.config.DefaultCharset, m.config.DefaultCollation); createErr != nil {
 			return nil, fmt.Errorf("failed to auto-create database for tenant %s: %w", tenantID, createErr)
 		}
 
 		// 重新尝试连接
-		db, err = gorm.Open(mysql.Open(dsn), m.defaultConfig)
+		db, err = gorm.Open(dialect.Open(dsn), m.defaultConfig)
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to newly created database for tenant %s: %w", tenantID, err)
 		}
@@ -268,32 +505,99 @@ func (m *TenantDBManager) createDB(tenantID string) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database for tenant %s: %w", tenantID, err)
 	}
 
-	// 添加OpenTelemetry
-	if m.config.EnableTracing {
-		if err := db.Use(tracing.NewPlugin(tracing.WithoutMetrics())); err != nil {
-			return nil, fmt.Errorf("failed to setup tracing for tenant %s: %w", tenantID, err)
+	// 注册只读副本并设置连接池
+	m.mutex.RLock()
+	replicaDSNs := m.resolveReplicaDSNs(tenantID)
+	m.mutex.RUnlock()
+	if err = useReplicas(db, dialect, replicaDSNs); err != nil {
+		err = fmt.Errorf("failed to setup replicas for tenant %s: %w", tenantID, err)
+	} else {
+		m.mutex.RLock()
+		err = m.applyPoolConfig(tenantID, db)
+		m.mutex.RUnlock()
+	}
+	if err == nil && tenantID != "" && m.config.Audit != nil {
+		// 添加审计插件
+		if auditErr := db.Use(newAuditPlugin(m.config.Audit, tenantID)); auditErr != nil {
+			err = fmt.Errorf("failed to setup audit for tenant %s: %w", tenantID, auditErr)
 		}
 	}
-
-	// 存储连接
-	m.dbs[tenantID] = db
-
-	// 如果是租户库，执行迁移
-	if tenantID != "" && m.config.MigrateFunc != nil {
-		if err := m.config.MigrateFunc(db); err != nil {
-			return nil, fmt.Errorf("failed to migrate database for tenant %s: %w", tenantID, err)
+	if err == nil && tenantID != "" && m.config.Quota != nil {
+		// 添加配额插件
+		if quotaErr := db.Use(&quotaPlugin{quota: m.config.Quota, tenantID: tenantID}); quotaErr != nil {
+			err = fmt.Errorf("failed to setup quota for tenant %s: %w", tenantID, quotaErr)
+		}
+	}
+	if err == nil && m.config.EnableTracing {
+		// 添加OpenTelemetry
+		if tracingErr := db.Use(tracing.NewPlugin()); tracingErr != nil {
+			err = fmt.Errorf("failed to setup tracing for tenant %s: %w", tenantID, tracingErr)
 		}
 	}
+	if err != nil {
+		closeDB(db)
+		return nil, err
+	}
 
 	return db, nil
 }
 
+// createFailure 租户连接创建失败记录
+type createFailure struct {
+	attempts int
+	retryAt  time.Time
+	err      error
+}
+
+// checkBackoff 检查租户是否处于创建失败后的退避期
+func (m *TenantDBManager) checkBackoff(tenantID string) error {
+	m.mutex.RLock()
+	failure, ok := m.failures[tenantID]
+	m.mutex.RUnlock()
+
+	if !ok || !time.Now().Before(failure.retryAt) {
+		return nil
+	}
+
+	return fmt.Errorf("tenant %s is backing off until %s: %w",
+		tenantID, failure.retryAt.Format(time.RFC3339), failure.err)
+}
+
+// recordFailure 记录租户连接创建失败，并按指数退避计算下次重试时间
+func (m *TenantDBManager) recordFailure(tenantID string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	failure, ok := m.failures[tenantID]
+	if !ok {
+		failure = &createFailure{}
+		m.failures[tenantID] = failure
+	}
+	failure.attempts++
+	failure.err = err
+
+	backoff := m.config.RetryBackoff
+	for i := 1; i < failure.attempts && backoff < m.config.MaxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > m.config.MaxRetryBackoff {
+		backoff = m.config.MaxRetryBackoff
+	}
+	failure.retryAt = time.Now().Add(backoff)
+}
+
 // RegisterTenant 注册特定租户的DSN
 func (m *TenantDBManager) RegisterTenant(tenantID string, dsn string) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	if m.config.TenantDSNs[tenantID] != dsn {
+		m.generations[tenantID]++
+	}
 	m.config.TenantDSNs[tenantID] = dsn
+	// DSN变化后允许立即重试
+	delete(m.failures, tenantID)
+	delete(m.deprovisioned, tenantID)
 }
 
 // SetMigrateFunc 设置迁移函数
@@ -301,17 +605,19 @@ func (m *TenantDBManager) SetMigrateFunc(migrateFunc MigrateFunc) {
 	m.config.MigrateFunc = migrateFunc
 }
 
-// CloseAll 关闭所有数据库连接
+// CloseAll 关闭所有数据库连接，并停止空闲连接池淘汰
 func (m *TenantDBManager) CloseAll() {
+	m.stopOnce.Do(func() {
+		close(m.stopEvictor)
+	})
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	for tenantID, db := range m.dbs {
-		sqlDB, err := db.DB()
-		if err != nil {
-			continue
-		}
-		_ = sqlDB.Close()
+	for tenantID, elem := range m.dbs {
+		entry := m.lru.Remove(elem).(*tenantDBEntry)
 		delete(m.dbs, tenantID)
+		closeDB(entry.db)
 	}
+	m.closeRetired()
 }
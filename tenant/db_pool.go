@@ -0,0 +1,151 @@
+package tenant
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// PoolConfig 数据库连接池配置
+// 字段为零值时表示沿用默认配置
+type PoolConfig struct {
+	// 最大打开连接数
+	MaxOpenConns int
+
+	// 最大空闲连接数
+	MaxIdleConns int
+
+	// 连接最大存活时间
+	ConnMaxLifetime time.Duration
+
+	// 连接最大空闲时间
+	ConnMaxIdleTime time.Duration
+}
+
+// NewDefaultPoolConfig 创建带有默认值的连接池配置
+func NewDefaultPoolConfig() *PoolConfig {
+	return &PoolConfig{
+		MaxOpenConns:    20,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: time.Hour,
+		ConnMaxIdleTime: 10 * time.Minute,
+	}
+}
+
+// merge 用override中的非零字段覆盖当前配置，返回新的配置
+func (p *PoolConfig) merge(override *PoolConfig) *PoolConfig {
+	merged := &PoolConfig{}
+	if p != nil {
+		*merged = *p
+	}
+	if override == nil {
+		return merged
+	}
+
+	if override.MaxOpenConns != 0 {
+		merged.MaxOpenConns = override.MaxOpenConns
+	}
+	if override.MaxIdleConns != 0 {
+		merged.MaxIdleConns = override.MaxIdleConns
+	}
+	if override.ConnMaxLifetime != 0 {
+		merged.ConnMaxLifetime = override.ConnMaxLifetime
+	}
+	if override.ConnMaxIdleTime != 0 {
+		merged.ConnMaxIdleTime = override.ConnMaxIdleTime
+	}
+	return merged
+}
+
+// apply 将连接池配置应用到sql.DB，可用于已打开的连接池
+func (p *PoolConfig) apply(sqlDB *sql.DB) {
+	if p == nil {
+		return
+	}
+
+	if p.MaxOpenConns != 0 {
+		sqlDB.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns != 0 {
+		sqlDB.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime != 0 {
+		sqlDB.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime != 0 {
+		sqlDB.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+}
+
+// poolConfigFor 获取租户生效的连接池配置
+// 调用方需持有锁
+func (m *TenantDBManager) poolConfigFor(tenantID string) *PoolConfig {
+	return m.config.Pool.merge(m.config.TenantPools[tenantID])
+}
+
+// applyResolver 将连接池配置应用到主库和所有只读副本
+func (p *PoolConfig) applyResolver(resolver *dbresolver.DBResolver) {
+	if p == nil {
+		return
+	}
+
+	if p.MaxOpenConns != 0 {
+		resolver.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns != 0 {
+		resolver.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime != 0 {
+		resolver.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime != 0 {
+		resolver.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+}
+
+// applyPoolConfig 将租户的连接池配置应用到数据库连接
+func (m *TenantDBManager) applyPoolConfig(tenantID string, db *gorm.DB) error {
+	if resolver, ok := getResolver(db); ok {
+		m.poolConfigFor(tenantID).applyResolver(resolver)
+		return nil
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get sql.DB for tenant %s: %w", tenantID, err)
+	}
+
+	m.poolConfigFor(tenantID).apply(sqlDB)
+	return nil
+}
+
+// SetTenantPool 设置租户的连接池配置
+// 如果该租户的连接池已打开，则直接调整，无需重新连接
+func (m *TenantDBManager) SetTenantPool(tenantID string, pool *PoolConfig) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if pool == nil {
+		delete(m.config.TenantPools, tenantID)
+	} else {
+		m.config.TenantPools[tenantID] = pool
+	}
+
+	elem, ok := m.dbs[tenantID]
+	if !ok {
+		return nil
+	}
+
+	return m.applyPoolConfig(tenantID, elem.Value.(*tenantDBEntry).db)
+}
+
+// GetTenantPool 获取租户当前生效的连接池配置
+func (m *TenantDBManager) GetTenantPool(tenantID string) PoolConfig {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return *m.poolConfigFor(tenantID)
+}
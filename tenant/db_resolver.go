@@ -0,0 +1,96 @@
+package tenant
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// useReplicas 为数据库连接注册只读副本
+// 注册后查询路由到副本，写操作和事务使用主库
+func useReplicas(db *gorm.DB, dialect Dialect, replicaDSNs []string) error {
+	if len(replicaDSNs) == 0 {
+		return nil
+	}
+
+	replicas := make([]gorm.Dialector, 0, len(replicaDSNs))
+	for _, dsn := range replicaDSNs {
+		replicas = append(replicas, dialect.Open(dsn))
+	}
+
+	if err := db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RandomPolicy{},
+	})); err != nil {
+		return fmt.Errorf("failed to register replicas: %w", err)
+	}
+	return nil
+}
+
+// getResolver 获取数据库连接上注册的读写分离插件
+func getResolver(db *gorm.DB) (*dbresolver.DBResolver, bool) {
+	plugin, ok := db.Config.Plugins[(&dbresolver.DBResolver{}).Name()]
+	if !ok {
+		return nil, false
+	}
+	resolver, ok := plugin.(*dbresolver.DBResolver)
+	return resolver, ok
+}
+
+// UsePrimary 强制后续操作使用主库，用于写后立即读等需要读到最新数据的场景
+func UsePrimary(db *gorm.DB) *gorm.DB {
+	return db.Clauses(dbresolver.Write)
+}
+
+// UseReplica 强制后续操作使用只读副本
+func UseReplica(db *gorm.DB) *gorm.DB {
+	return db.Clauses(dbresolver.Read)
+}
+
+// closeReplicas 关闭数据库连接上注册的只读副本
+func closeReplicas(db *gorm.DB) {
+	resolver, ok := getResolver(db)
+	if !ok {
+		return
+	}
+
+	_ = resolver.Call(func(connPool gorm.ConnPool) error {
+		if closer, ok := connPool.(interface{ Close() error }); ok {
+			_ = closer.Close()
+		}
+		return nil
+	})
+}
+
+// closeDB 关闭数据库连接池，包括已注册的只读副本
+func closeDB(db *gorm.DB) {
+	closeReplicas(db)
+
+	if sqlDB, err := db.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+}
+
+// resolveReplicaDSNs 确定租户的只读副本DSN
+// 调用方需持有锁
+func (m *TenantDBManager) resolveReplicaDSNs(tenantID string) []string {
+	if dsns, ok := m.config.TenantReplicaDSNs[tenantID]; ok {
+		return dsns
+	}
+
+	dsns := make([]string, 0, len(m.config.ReplicaDSNTemplates))
+	for _, template := range m.config.ReplicaDSNTemplates {
+		dsns = append(dsns, fmt.Sprintf(template, tenantID))
+	}
+	return dsns
+}
+
+// RegisterTenantReplicas 注册特定租户的只读副本DSN
+// 已打开的连接池在下次重新打开后生效
+func (m *TenantDBManager) RegisterTenantReplicas(tenantID string, dsns ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.config.TenantReplicaDSNs[tenantID] = dsns
+}
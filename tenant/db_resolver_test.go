@@ -0,0 +1,146 @@
+package tenant
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// newReplicaFile 创建带有testActivity表的SQLite数据库文件，并写入names
+func newReplicaFile(t *testing.T, path string, names ...string) {
+	t.Helper()
+	db, err := gorm.Open(SQLite.Open(path), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+	defer closeDB(db)
+
+	if err := db.AutoMigrate(&testActivity{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	for _, name := range names {
+		if err := db.Create(&testActivity{Name: name}).Error; err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+}
+
+// activityNames 查询所有testActivity的名称
+func activityNames(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var names []string
+	if err := db.Model(&testActivity{}).Order("id").Pluck("name", &names).Error; err != nil {
+		t.Fatalf("Pluck() error = %v", err)
+	}
+	return names
+}
+
+func TestTenantDBManager_Replicas(t *testing.T) {
+	dir := t.TempDir()
+	primary := filepath.Join(dir, "primary.db")
+	replica := filepath.Join(dir, "replica.db")
+	newReplicaFile(t, primary)
+	newReplicaFile(t, replica, "replica")
+
+	config := NewDefaultDBConfig()
+	config.Dialect = SQLite
+	config.EnableTracing = false
+	config.TenantDSNs["tenant1"] = primary
+	config.TenantReplicaDSNs["tenant1"] = []string{replica}
+	manager := NewTenantDBManager(config)
+	t.Cleanup(manager.CloseAll)
+
+	db, err := manager.GetDB("tenant1")
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+
+	// 写操作使用主库
+	if err := db.Create(&testActivity{Name: "primary"}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// 查询路由到副本
+	if got := activityNames(t, db); len(got) != 1 || got[0] != "replica" {
+		t.Errorf("query names = %v, want [replica]", got)
+	}
+
+	// 强制使用主库
+	if got := activityNames(t, UsePrimary(db)); len(got) != 1 || got[0] != "primary" {
+		t.Errorf("UsePrimary() names = %v, want [primary]", got)
+	}
+
+	// 事务内的查询使用主库
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if got := activityNames(t, tx); len(got) != 1 || got[0] != "primary" {
+			t.Errorf("transaction names = %v, want [primary]", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+}
+
+func TestMigrator_LaggingReplica(t *testing.T) {
+	registry, err := NewMigrationRegistry(&Migration{
+		Version: 1,
+		Name:    "create_widgets",
+		Up: func(tx *gorm.DB) error {
+			// 重复执行时因表已存在而失败
+			return tx.Exec("CREATE TABLE widgets (id INTEGER PRIMARY KEY)").Error
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewMigrationRegistry() error = %v", err)
+	}
+	migrator := NewMigrator(registry, nil)
+	ctx := context.Background()
+
+	// 主库已执行迁移，副本的迁移记录表还是空的
+	dir := t.TempDir()
+	primary := filepath.Join(dir, "primary.db")
+	replica := filepath.Join(dir, "replica.db")
+	for _, path := range []string{primary, replica} {
+		db, err := gorm.Open(SQLite.Open(path), &gorm.Config{})
+		if err != nil {
+			t.Fatalf("gorm.Open() error = %v", err)
+		}
+		if path == primary {
+			_, err = migrator.Up(ctx, db)
+		} else {
+			err = migrator.ensureTables(db)
+		}
+		closeDB(db)
+		if err != nil {
+			t.Fatalf("prepare %s error = %v", filepath.Base(path), err)
+		}
+	}
+
+	config := NewDefaultDBConfig()
+	config.Dialect = SQLite
+	config.EnableTracing = false
+	config.Migrator = migrator
+	config.TenantDSNs["tenant1"] = primary
+	config.TenantReplicaDSNs["tenant1"] = []string{replica}
+	manager := NewTenantDBManager(config)
+	t.Cleanup(manager.CloseAll)
+
+	// 首次连接时执行迁移，已执行的迁移不会因读到副本而重复执行
+	db, err := manager.GetDB("tenant1")
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	if done, err := migrator.Up(ctx, db); err != nil || len(done) != 0 {
+		t.Errorf("Up() = %v, %v, want no migrations", len(done), err)
+	}
+	if pending, err := migrator.Pending(ctx, db); err != nil || len(pending) != 0 {
+		t.Errorf("Pending() = %v, %v, want none", len(pending), err)
+	}
+	statuses, err := manager.MigrationStatus(ctx, "tenant1")
+	if err != nil || len(statuses) != 1 || !statuses[0].Applied {
+		t.Errorf("MigrationStatus() = %+v, %v, want version 1 applied", statuses, err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/onebids/onecommon/tenant"
+	"gorm.io/gorm"
+)
+
+// 示例模型
+type Activity struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"size:100"`
+}
+
+// 全量租户迁移命令示例
+//
+//	go run ./tenant/examples/migrate -dry-run
+//	go run ./tenant/examples/migrate -concurrency 8 -fail-fast
+//	go run ./tenant/examples/migrate -tenants tenant1,tenant2
+func main() {
+	registry, err := tenant.NewMigrationRegistry(
+		&tenant.Migration{
+			Version: 20240101000000,
+			Name:    "create_activities",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&Activity{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&Activity{})
+			},
+		},
+	)
+	if err != nil {
+		log.Fatalf("注册迁移失败: %v", err)
+	}
+
+	config := tenant.NewDefaultDBConfig()
+	config.DSNTemplate = "user:password@tcp(localhost:3306)/%s?charset=utf8mb4&parseTime=True&loc=Local"
+	config.TenantDSNs = map[string]string{
+		"tenant1": "user:password@tcp(localhost:3306)/tenant1?charset=utf8mb4&parseTime=True&loc=Local",
+		"tenant2": "user:password@tcp(localhost:3306)/tenant2?charset=utf8mb4&parseTime=True&loc=Local",
+	}
+	config.Migrator = tenant.NewMigrator(registry, nil)
+
+	dbManager := tenant.NewTenantDBManager(config)
+	code := tenant.RunMigrateCommand(context.Background(), dbManager, nil, os.Args[1:], os.Stdout)
+	dbManager.CloseAll()
+
+	os.Exit(code)
+}
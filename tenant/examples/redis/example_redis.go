@@ -19,21 +19,37 @@ type User struct {
 func main() {
 	// 创建Redis管理器配置
 	config := &tenant.RedisConfig{
-		DefaultOptions: &redis.Options{
-			Addr:     "localhost:6379",
-			Password: "", // 无密码
-			DB:       0,  // 默认数据库
+		DefaultOptions: &tenant.RedisOptions{
+			Mode: tenant.RedisStandalone,
+			UniversalOptions: redis.UniversalOptions{
+				Addrs:    []string{"localhost:6379"},
+				Password: "", // 无密码
+				DB:       0,  // 默认数据库
+			},
 		},
-		TenantOptions: map[string]*redis.Options{
+		TenantOptions: map[string]*tenant.RedisOptions{
 			"tenant1": {
-				Addr:     "localhost:6379",
-				Password: "",
-				DB:       1, // 使用不同的数据库隔离租户
+				Mode: tenant.RedisStandalone,
+				UniversalOptions: redis.UniversalOptions{
+					Addrs:    []string{"localhost:6379"},
+					Password: "",
+					DB:       1, // 使用不同的数据库隔离租户
+				},
 			},
 			"tenant2": {
-				Addr:     "localhost:6379",
-				Password: "",
-				DB:       2,
+				// 哨兵模式，主节点故障时自动切换
+				Mode: tenant.RedisSentinel,
+				UniversalOptions: redis.UniversalOptions{
+					MasterName: "mymaster",
+					Addrs:      []string{"localhost:26379"},
+				},
+			},
+			"tenant3": {
+				// 集群模式，key前缀为{tenant3}:，同一租户的key落在同一个slot
+				Mode: tenant.RedisCluster,
+				UniversalOptions: redis.UniversalOptions{
+					Addrs: []string{"localhost:7000", "localhost:7001", "localhost:7002"},
+				},
 			},
 		},
 		EnableTenantIsolation: true,
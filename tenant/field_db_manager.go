@@ -8,15 +8,19 @@ import (
 	"sync"
 	"time"
 
-	"gorm.io/driver/mysql"
+	"github.com/onebids/onecommon/tools"
+	"github.com/prometheus/client_golang/prometheus"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 	"gorm.io/plugin/opentelemetry/tracing"
 )
 
 // FieldDBConfig 字段级隔离数据库管理器配置
 type FieldDBConfig struct {
+	// SQL方言
+	// 默认值: MySQL
+	Dialect Dialect
+
 	// DSN连接字符串
 	// 默认值: 空字符串，必须由用户提供
 	DSN string
@@ -41,14 +45,46 @@ type FieldDBConfig struct {
 	// 默认值: nil (不执行迁移)
 	MigrateFunc MigrateFunc
 
+	// 版本化迁移引擎，连接时执行未执行的迁移
+	// 默认值: nil (不执行版本化迁移)
+	Migrator *Migrator
+
 	// 租户ID字段名
 	// 默认值: "tenant_id"
 	TenantIDField string
+
+	// 租户内的下级隔离列，例如组织或门店，按层级从上到下排列
+	// 默认值: nil (只按租户隔离)
+	Scopes []ScopeColumn
+
+	// 判断调用方是否可以通过WidenToTenant忽略下级隔离列
+	// 默认值: nil (不允许放宽)
+	WidenPermission func(ctx context.Context) bool
+
+	// 审计配置，设置后自动填充创建人、更新人并记录变更历史
+	// 默认值: nil (不启用审计)
+	Audit *AuditConfig
+
+	// 租户行数配额，设置后创建记录前按上下文中的租户检查配额
+	// 默认值: nil (不限制)
+	Quota *TenantQuota
+
+	// 严格模式，上下文中既没有租户ID也没有WithSystemScope时GetDB返回错误
+	// 下级隔离列缺少值且未放宽到租户级别时同样返回错误
+	// 查询中使用字符串形式的原生连接且未AllowRawSQL时返回ErrRawJoinNotAllowed
+	// 默认值: false (返回不带租户过滤的连接)
+	StrictMode bool
+
+	// 共享数据库的只读副本DSN
+	// 配置后查询路由到副本，写操作和事务使用主库
+	// 默认值: nil (不使用副本)
+	ReplicaDSNs []string
 }
 
 // NewDefaultFieldDBConfig 创建带有默认值的字段级隔离配置
 func NewDefaultFieldDBConfig() *FieldDBConfig {
 	return &FieldDBConfig{
+		Dialect:       MySQL,
 		EnableTracing: false,
 		LogLevel:      logger.Error,
 		SlowThreshold: 200 * time.Millisecond,
@@ -74,6 +110,8 @@ type FieldDBManager struct {
 	mutex         sync.RWMutex
 	config        *FieldDBConfig
 	defaultConfig *gorm.Config
+	plugin        *TenantPlugin
+	systemScopes  prometheus.Counter
 }
 
 // NewFieldDBManager 创建字段级租户隔离数据库管理器
@@ -85,6 +123,11 @@ func NewFieldDBManager(config *FieldDBConfig) *FieldDBManager {
 		// 填充默认值
 		defaultConfig := NewDefaultFieldDBConfig()
 
+		// 未指定方言时使用MySQL
+		if config.Dialect == nil {
+			config.Dialect = defaultConfig.Dialect
+		}
+
 		// 租户ID字段为空时使用默认值
 		if config.TenantIDField == "" {
 			config.TenantIDField = defaultConfig.TenantIDField
@@ -118,9 +161,15 @@ func NewFieldDBManager(config *FieldDBConfig) *FieldDBManager {
 		}
 	}
 
+	plugin := NewTenantPlugin(config.TenantIDField, config.Scopes...)
+	plugin.WidenPermission = config.WidenPermission
+	plugin.StrictJoins = config.StrictMode
+
 	return &FieldDBManager{
 		config:        config,
 		defaultConfig: config.DBConfig,
+		plugin:        plugin,
+		systemScopes:  newSystemScopeCounter("field"),
 	}
 }
 
@@ -138,21 +187,68 @@ func (m *FieldDBManager) Connect() error {
 	}
 
 	// 创建新的DB连接
-	db, err := gorm.Open(mysql.Open(m.config.DSN), m.defaultConfig)
+	db, err := gorm.Open(m.config.Dialect.Open(m.config.DSN), m.defaultConfig)
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// 注册只读副本
+	if err := useReplicas(db, m.config.Dialect, m.config.ReplicaDSNs); err != nil {
+		closeDB(db)
+		return fmt.Errorf("failed to setup replicas: %w", err)
+	}
+
+	// 注册租户隔离插件
+	if err := db.Use(m.plugin); err != nil {
+		closeDB(db)
+		return fmt.Errorf("failed to setup tenant plugin: %w", err)
+	}
+
+	// 注册审计插件
+	var audit *AuditPlugin
+	if m.config.Audit != nil {
+		audit = NewAuditPlugin(m.config.Audit)
+		if err := db.Use(audit); err != nil {
+			closeDB(db)
+			return fmt.Errorf("failed to setup audit: %w", err)
+		}
+	}
+
+	// 注册配额插件
+	if m.config.Quota != nil {
+		if err := db.Use(&quotaPlugin{quota: m.config.Quota}); err != nil {
+			closeDB(db)
+			return fmt.Errorf("failed to setup quota: %w", err)
+		}
+	}
+
 	// 添加OpenTelemetry
 	if m.config.EnableTracing {
-		if err := db.Use(tracing.NewPlugin(tracing.WithoutMetrics())); err != nil {
+		if err := db.Use(tracing.NewPlugin()); err != nil {
+			closeDB(db)
 			return fmt.Errorf("failed to setup tracing: %w", err)
 		}
 	}
 
-	// 存储连接
+	// 迁移全部成功后才存储连接，失败时关闭连接，下次Connect重新连接并迁移
+	if err := m.migrate(db, audit); err != nil {
+		closeDB(db)
+		return err
+	}
 	m.db = db
 
+	return nil
+}
+
+// migrate 创建变更历史表并执行迁移
+func (m *FieldDBManager) migrate(db *gorm.DB, audit *AuditPlugin) error {
+	// 创建变更历史表
+	if audit != nil {
+		if err := audit.Migrate(db); err != nil {
+			return err
+		}
+	}
+
 	// 执行迁移
 	if m.config.MigrateFunc != nil {
 		if err := m.config.MigrateFunc(db); err != nil {
@@ -160,24 +256,30 @@ func (m *FieldDBManager) Connect() error {
 		}
 	}
 
+	// 执行版本化迁移
+	if m.config.Migrator != nil {
+		if _, err := m.config.Migrator.Up(context.Background(), db); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
 	return nil
 }
 
-// tenantContext 用于存储租户ID的上下文键
-type tenantContextKey struct{}
-
-// WithTenant 创建包含租户ID的上下文
+// WithTenant 创建包含租户ID的上下文，等同于tools.WithTenant
 func WithTenant(ctx context.Context, tenantID string) context.Context {
-	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+	return tools.WithTenant(ctx, tenantID)
 }
 
 // GetTenantFromContext 从上下文中获取租户ID
+// 使用tools.DefaultTenantResolver解析，其他包设置的租户ID同样可见
 func GetTenantFromContext(ctx context.Context) (string, bool) {
-	tenantID, ok := ctx.Value(tenantContextKey{}).(string)
-	return tenantID, ok
+	return tools.ResolveTenant(ctx)
 }
 
 // GetDB 获取带有租户过滤的数据库连接
+// 上下文带有WithSystemScope时不做租户过滤，并记录日志和指标
+// 上下文中没有租户ID时，严格模式返回ErrMissingTenant，否则不做租户过滤
+// 使用WidenToTenant但没有权限时返回ErrScopeWidenDenied
 func (m *FieldDBManager) GetDB(ctx context.Context) (*gorm.DB, error) {
 	m.mutex.RLock()
 	db := m.db
@@ -187,48 +289,40 @@ func (m *FieldDBManager) GetDB(ctx context.Context) (*gorm.DB, error) {
 		return nil, fmt.Errorf("database not connected, call Connect() first")
 	}
 
-	// 从上下文中获取租户ID
-	tenantID, ok := GetTenantFromContext(ctx)
-	if !ok || tenantID == "" {
-		fmt.Println("tenantID为空")
-		return db, nil // 没有租户ID，返回原始DB
+	if reason, ok := GetSystemScope(ctx); ok {
+		recordSystemScope(ctx, m.systemScopes, reason)
+		return db.WithContext(ctx), nil
 	}
-	fmt.Println("tenantID:", tenantID)
-	// 创建带有租户过滤的新会话
-	tenantDB := db.Session(&gorm.Session{NewDB: true})
-
-	// 添加全局租户过滤回调
-	tenantDB.Callback().Query().Before("gorm:query").Register("tenant_filter", func(db *gorm.DB) {
-		fmt.Println("执行租户过滤回调")
-		// 检查模型是否有租户ID字段
-		if db.Statement.Schema != nil {
-			fmt.Println("租户ID字段存在")
-			if _, ok := db.Statement.Schema.FieldsByDBName[m.config.TenantIDField]; ok {
-				// 添加租户过滤条件
-				db.Statement.AddClause(clause.Where{
-					Exprs: []clause.Expression{
-						clause.Eq{
-							Column: clause.Column{Table: clause.CurrentTable, Name: m.config.TenantIDField},
-							Value:  tenantID,
-						},
-					},
-				})
-			}
-		}
-	})
 
-	// 添加创建回调以自动设置租户ID
-	tenantDB.Callback().Create().Before("gorm:create").Register("tenant_create", func(db *gorm.DB) {
-		// 检查模型是否有租户ID字段
-		if db.Statement.Schema != nil {
-			if field, ok := db.Statement.Schema.FieldsByDBName[m.config.TenantIDField]; ok {
-				field.Set(db.Statement.Context, db.Statement.ReflectValue, tenantID)
+	if _, err := m.plugin.scopeValues(ctx); err != nil {
+		return nil, err
+	}
 
-			}
+	if m.config.StrictMode {
+		if err := m.checkStrictScopes(ctx); err != nil {
+			return nil, err
 		}
-	})
+	}
+
+	// 租户过滤由TenantPlugin在执行时从上下文读取
+	return db.WithContext(ctx), nil
+}
+
+// checkStrictScopes 严格模式下检查上下文中的租户ID和下级隔离列
+func (m *FieldDBManager) checkStrictScopes(ctx context.Context) error {
+	if tenantID, ok := GetTenantFromContext(ctx); !ok || tenantID == "" {
+		return ErrMissingTenant
+	}
+	if isWidened(ctx) {
+		return nil
+	}
 
-	return tenantDB, nil
+	for _, scope := range m.config.Scopes {
+		if _, ok := scope.resolve(ctx); !ok {
+			return fmt.Errorf("%w: %s", ErrMissingScope, scope.Field)
+		}
+	}
+	return nil
 }
 
 // SetMigrateFunc 设置迁移函数
@@ -245,6 +339,8 @@ func (m *FieldDBManager) Close() error {
 		return nil
 	}
 
+	closeReplicas(m.db)
+
 	sqlDB, err := m.db.DB()
 	if err != nil {
 		return err
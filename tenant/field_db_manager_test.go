@@ -0,0 +1,732 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/onebids/onecommon/consts"
+	"github.com/onebids/onecommon/tools"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type testFieldUser struct {
+	ID       uint   `gorm:"primarykey"`
+	Name     string `gorm:"size:100"`
+	TenantID string `gorm:"size:50;index"`
+}
+
+type testFieldCompany struct {
+	ID       uint   `gorm:"primarykey"`
+	Name     string `gorm:"size:100"`
+	TenantID string `gorm:"size:50;index"`
+}
+
+type testFieldOrder struct {
+	ID        uint   `gorm:"primarykey"`
+	AccountID uint   `gorm:"index"`
+	Item      string `gorm:"size:100"`
+	TenantID  string `gorm:"size:50;index"`
+}
+
+type testFieldAccount struct {
+	ID        uint   `gorm:"primarykey"`
+	Name      string `gorm:"size:100"`
+	TenantID  string `gorm:"size:50;index"`
+	CompanyID uint
+	Company   testFieldCompany
+	Orders    []testFieldOrder `gorm:"foreignKey:AccountID"`
+}
+
+type testFieldItem struct {
+	ID       uint   `gorm:"primarykey"`
+	Name     string `gorm:"size:100"`
+	TenantID string `gorm:"size:50;index"`
+	OrgID    string `gorm:"size:50;index"`
+}
+
+func newTestFieldDBManager(t *testing.T, options ...func(*FieldDBConfig)) *FieldDBManager {
+	t.Helper()
+	config := NewDefaultFieldDBConfig()
+	config.Dialect = SQLite
+	config.DSN = filepath.Join(t.TempDir(), "shared.db")
+	config.MigrateFunc = func(db *gorm.DB) error {
+		return db.AutoMigrate(&testFieldUser{}, &testFieldCompany{}, &testFieldOrder{}, &testFieldAccount{}, &testFieldItem{})
+	}
+	for _, option := range options {
+		option(config)
+	}
+
+	manager := NewFieldDBManager(config)
+	if err := manager.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() { _ = manager.Close() })
+	return manager
+}
+
+func TestFieldDBManager_ConnectMigrationFailure(t *testing.T) {
+	config := NewDefaultFieldDBConfig()
+	config.Dialect = SQLite
+	config.DSN = filepath.Join(t.TempDir(), "shared.db")
+	config.EnableTracing = false
+	migrateErr := errors.New("migration failed")
+	attempts := 0
+	config.MigrateFunc = func(db *gorm.DB) error {
+		attempts++
+		if attempts == 1 {
+			return migrateErr
+		}
+		return db.AutoMigrate(&testFieldUser{})
+	}
+
+	manager := NewFieldDBManager(config)
+	t.Cleanup(func() { _ = manager.Close() })
+
+	// 迁移失败时不保留连接，再次Connect会重新迁移
+	if err := manager.Connect(); !errors.Is(err, migrateErr) {
+		t.Fatalf("Connect() error = %v, want %v", err, migrateErr)
+	}
+	if _, err := manager.GetDB(WithSystemScope(context.Background(), "test")); err == nil {
+		t.Errorf("GetDB() after failed Connect error = nil, want error")
+	}
+	if err := manager.Connect(); err != nil {
+		t.Fatalf("Connect() retry error = %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("migration attempts = %v, want %v", attempts, 2)
+	}
+}
+
+func TestFieldDBManager_GetDB(t *testing.T) {
+	manager := newTestFieldDBManager(t)
+
+	db, err := manager.GetDB(WithTenant(context.Background(), "tenant-a"))
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+
+	user := testFieldUser{Name: "Alice"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if user.TenantID != "tenant-a" {
+		t.Errorf("Create() TenantID = %v, want %v", user.TenantID, "tenant-a")
+	}
+
+	var users []testFieldUser
+	if err := db.Find(&users).Error; err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(users) != 1 {
+		t.Errorf("Find() = %v users, want %v", len(users), 1)
+	}
+}
+
+// seedFieldUsers 使用不带租户的连接写入两个租户的数据
+func seedFieldUsers(t *testing.T, manager *FieldDBManager) (alice, bob testFieldUser) {
+	t.Helper()
+	alice = testFieldUser{Name: "Alice", TenantID: "tenant-a"}
+	bob = testFieldUser{Name: "Bob", TenantID: "tenant-b"}
+	if err := manager.db.Create([]*testFieldUser{&alice, &bob}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return alice, bob
+}
+
+// countFieldUsers 绕过GORM回调直接统计数据
+func countFieldUsers(t *testing.T, manager *FieldDBManager, where string, args ...interface{}) int {
+	t.Helper()
+	sqlDB, err := manager.db.DB()
+	if err != nil {
+		t.Fatalf("DB() error = %v", err)
+	}
+
+	var count int
+	if err := sqlDB.QueryRow("SELECT count(*) FROM test_field_users WHERE "+where, args...).Scan(&count); err != nil {
+		t.Fatalf("QueryRow() error = %v", err)
+	}
+	return count
+}
+
+func TestFieldDBManager_CrossTenantWrites(t *testing.T) {
+	tests := []struct {
+		name      string
+		write     func(db *gorm.DB, bob testFieldUser) *gorm.DB
+		wantErr   error
+		wantAlice int
+		wantBob   int
+	}{
+		{
+			name: "update by primary key",
+			write: func(db *gorm.DB, bob testFieldUser) *gorm.DB {
+				return db.Model(&testFieldUser{ID: bob.ID}).Update("name", "hacked")
+			},
+			wantAlice: 1,
+			wantBob:   1,
+		},
+		{
+			name: "update all",
+			write: func(db *gorm.DB, bob testFieldUser) *gorm.DB {
+				return db.Model(&testFieldUser{}).Where("1 = 1").Update("name", "hacked")
+			},
+			wantAlice: 0,
+			wantBob:   1,
+		},
+		{
+			name: "delete by primary key",
+			write: func(db *gorm.DB, bob testFieldUser) *gorm.DB {
+				return db.Delete(&testFieldUser{}, bob.ID)
+			},
+			wantAlice: 1,
+			wantBob:   1,
+		},
+		{
+			name: "delete all",
+			write: func(db *gorm.DB, bob testFieldUser) *gorm.DB {
+				return db.Where("1 = 1").Delete(&testFieldUser{})
+			},
+			wantAlice: 0,
+			wantBob:   1,
+		},
+		{
+			name: "delete without conditions",
+			write: func(db *gorm.DB, bob testFieldUser) *gorm.DB {
+				return db.Delete(&testFieldUser{})
+			},
+			wantErr:   gorm.ErrMissingWhereClause,
+			wantAlice: 1,
+			wantBob:   1,
+		},
+		{
+			name: "save with other tenant primary key",
+			write: func(db *gorm.DB, bob testFieldUser) *gorm.DB {
+				return db.Save(&testFieldUser{ID: bob.ID, Name: "hacked"})
+			},
+			wantAlice: 1,
+			wantBob:   1,
+		},
+		{
+			name: "upsert update all",
+			write: func(db *gorm.DB, bob testFieldUser) *gorm.DB {
+				return db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&testFieldUser{ID: bob.ID, Name: "hacked"})
+			},
+			wantAlice: 1,
+			wantBob:   1,
+		},
+		{
+			name: "upsert do updates",
+			write: func(db *gorm.DB, bob testFieldUser) *gorm.DB {
+				return db.Clauses(clause.OnConflict{
+					Columns:   []clause.Column{{Name: "id"}},
+					DoUpdates: clause.AssignmentColumns([]string{"name", "tenant_id"}),
+				}).Create(&testFieldUser{ID: bob.ID, Name: "hacked"})
+			},
+			wantAlice: 1,
+			wantBob:   1,
+		},
+		{
+			name: "raw exec",
+			write: func(db *gorm.DB, bob testFieldUser) *gorm.DB {
+				return db.Exec("DELETE FROM test_field_users")
+			},
+			wantErr:   ErrRawSQLNotAllowed,
+			wantAlice: 1,
+			wantBob:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestFieldDBManager(t)
+			_, bob := seedFieldUsers(t, manager)
+
+			db, err := manager.GetDB(WithTenant(context.Background(), "tenant-a"))
+			if err != nil {
+				t.Fatalf("GetDB() error = %v", err)
+			}
+
+			err = tt.write(db, bob).Error
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("write error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got := countFieldUsers(t, manager, "name = ?", "Alice"); got != tt.wantAlice {
+				t.Errorf("Alice rows = %v, want %v", got, tt.wantAlice)
+			}
+			if got := countFieldUsers(t, manager, "name = ? AND tenant_id = ?", "Bob", "tenant-b"); got != tt.wantBob {
+				t.Errorf("Bob rows = %v, want %v", got, tt.wantBob)
+			}
+		})
+	}
+}
+
+func TestFieldDBManager_TenantFieldChange(t *testing.T) {
+	manager := newTestFieldDBManager(t)
+	alice, _ := seedFieldUsers(t, manager)
+
+	db, err := manager.GetDB(WithTenant(context.Background(), "tenant-a"))
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+
+	err = db.Model(&alice).Update("tenant_id", "tenant-b").Error
+	if !errors.Is(err, ErrTenantFieldChanged) {
+		t.Errorf("Update() error = %v, want %v", err, ErrTenantFieldChanged)
+	}
+
+	err = db.Model(&alice).Updates(testFieldUser{Name: "Alice", TenantID: "tenant-b"}).Error
+	if !errors.Is(err, ErrTenantFieldChanged) {
+		t.Errorf("Updates() error = %v, want %v", err, ErrTenantFieldChanged)
+	}
+
+	// Save时租户ID为空会被设置为当前租户
+	alice.TenantID = ""
+	alice.Name = "Alice2"
+	if err := db.Save(&alice).Error; err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if got := countFieldUsers(t, manager, "name = ? AND tenant_id = ?", "Alice2", "tenant-a"); got != 1 {
+		t.Errorf("Save() rows = %v, want %v", got, 1)
+	}
+}
+
+func TestFieldDBManager_Upsert(t *testing.T) {
+	manager := newTestFieldDBManager(t)
+	alice, _ := seedFieldUsers(t, manager)
+
+	db, err := manager.GetDB(WithTenant(context.Background(), "tenant-a"))
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+
+	// 冲突行属于当前租户时正常更新
+	err = db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&testFieldUser{ID: alice.ID, Name: "Alice2"}).Error
+	if err != nil {
+		t.Fatalf("Create() upsert error = %v", err)
+	}
+	if got := countFieldUsers(t, manager, "name = ? AND tenant_id = ?", "Alice2", "tenant-a"); got != 1 {
+		t.Errorf("upsert rows = %v, want %v", got, 1)
+	}
+
+	// MySQL不支持ON DUPLICATE KEY UPDATE ... WHERE，赋值改写为按租户条件取值
+	dialector := mysql.New(mysql.Config{DSN: "user:pass@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true})
+	mysqlDB, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+	if err := mysqlDB.Use(NewTenantPlugin("tenant_id")); err != nil {
+		t.Fatalf("Use() error = %v", err)
+	}
+	stmt := mysqlDB.WithContext(WithTenant(context.Background(), "tenant-a")).
+		Clauses(clause.OnConflict{UpdateAll: true}).Create(&testFieldUser{ID: 1, Name: "hacked"}).Statement
+	want := "ON DUPLICATE KEY UPDATE `name`=IF(`tenant_id` = ?, VALUES(`name`), `name`),`tenant_id`=IF(`tenant_id` = ?, VALUES(`tenant_id`), `tenant_id`)"
+	if stmt.Error != nil {
+		t.Fatalf("mysql upsert error = %v", stmt.Error)
+	}
+	if got := stmt.SQL.String(); !strings.Contains(got, want) {
+		t.Errorf("mysql upsert SQL = %v, want contains %v", got, want)
+	}
+}
+
+func TestFieldDBManager_RawSQL(t *testing.T) {
+	manager := newTestFieldDBManager(t)
+	seedFieldUsers(t, manager)
+
+	db, err := manager.GetDB(WithTenant(context.Background(), "tenant-a"))
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+
+	var users []testFieldUser
+	err = db.Raw("SELECT * FROM test_field_users").Scan(&users).Error
+	if !errors.Is(err, ErrRawSQLNotAllowed) {
+		t.Errorf("Raw() error = %v, want %v", err, ErrRawSQLNotAllowed)
+	}
+
+	var count int64
+	if err := AllowRawSQL(db).Raw("SELECT count(*) FROM test_field_users").Scan(&count).Error; err != nil {
+		t.Fatalf("AllowRawSQL() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("AllowRawSQL() count = %v, want %v", count, 2)
+	}
+}
+
+func TestFieldDBManager_ConcurrentTenants(t *testing.T) {
+	manager := newTestFieldDBManager(t)
+	tenants := []string{"tenant-a", "tenant-b", "tenant-c"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(tenants)*10)
+	for _, tenantID := range tenants {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(tenantID string, i int) {
+				defer wg.Done()
+				db, err := manager.GetDB(WithTenant(context.Background(), tenantID))
+				if err != nil {
+					errs <- err
+					return
+				}
+				errs <- db.Create(&testFieldUser{Name: fmt.Sprintf("%s-%d", tenantID, i)}).Error
+			}(tenantID, i)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	for _, tenantID := range tenants {
+		db, err := manager.GetDB(WithTenant(context.Background(), tenantID))
+		if err != nil {
+			t.Fatalf("GetDB() error = %v", err)
+		}
+
+		var users []testFieldUser
+		if err := db.Find(&users).Error; err != nil {
+			t.Fatalf("Find() error = %v", err)
+		}
+		if len(users) != 10 {
+			t.Errorf("Find(%s) = %v users, want %v", tenantID, len(users), 10)
+		}
+		for _, user := range users {
+			if user.TenantID != tenantID {
+				t.Errorf("Find(%s) TenantID = %v, want %v", tenantID, user.TenantID, tenantID)
+			}
+		}
+	}
+
+	// 不带租户的上下文不做过滤
+	db, err := manager.GetDB(context.Background())
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	var count int64
+	if err := db.Model(&testFieldUser{}).Count(&count).Error; err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if count != 30 {
+		t.Errorf("Count() = %v, want %v", count, 30)
+	}
+}
+
+func TestFieldDBManager_StrictMode(t *testing.T) {
+	manager := newTestFieldDBManager(t)
+	manager.config.StrictMode = true
+	seedFieldUsers(t, manager)
+
+	registry := prometheus.NewRegistry()
+	if err := manager.RegisterMetrics(registry); err != nil {
+		t.Fatalf("RegisterMetrics() error = %v", err)
+	}
+
+	if _, err := manager.GetDB(context.Background()); !errors.Is(err, ErrMissingTenant) {
+		t.Errorf("GetDB() error = %v, want %v", err, ErrMissingTenant)
+	}
+	if _, err := manager.GetDB(WithSystemScope(context.Background(), "")); !errors.Is(err, ErrMissingTenant) {
+		t.Errorf("GetDB() with empty reason error = %v, want %v", err, ErrMissingTenant)
+	}
+
+	// 跨租户访问优先于上下文中的租户ID
+	ctx := WithSystemScope(WithTenant(context.Background(), "tenant-a"), "billing-report")
+	db, err := manager.GetDB(ctx)
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	var count int64
+	if err := db.Model(&testFieldUser{}).Count(&count).Error; err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Count() = %v, want %v", count, 2)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	var got float64
+	for _, family := range families {
+		if family.GetName() != "tenant_system_scope_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			got += metric.GetCounter().GetValue()
+			// 访问原因只记录在日志中，不作为标签
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "reason" {
+					t.Errorf("tenant_system_scope_total has reason label %v", label.GetValue())
+				}
+			}
+		}
+	}
+	if got != 1 {
+		t.Errorf("tenant_system_scope_total = %v, want %v", got, 1)
+	}
+}
+
+func TestFieldDBManager_RawJoins(t *testing.T) {
+	rawJoin := "JOIN test_field_orders ON test_field_orders.account_id = test_field_accounts.id"
+	tests := []struct {
+		name    string
+		strict  bool
+		query   func(db *gorm.DB) *gorm.DB
+		wantErr error
+	}{
+		{
+			name:    "strict raw join",
+			strict:  true,
+			query:   func(db *gorm.DB) *gorm.DB { return db.Joins(rawJoin) },
+			wantErr: ErrRawJoinNotAllowed,
+		},
+		{
+			name:   "strict association join",
+			strict: true,
+			query:  func(db *gorm.DB) *gorm.DB { return db.Joins("Company") },
+		},
+		{
+			name:   "strict raw join allowed",
+			strict: true,
+			query:  func(db *gorm.DB) *gorm.DB { return AllowRawSQL(db).Joins(rawJoin) },
+		},
+		{
+			name:  "raw join without strict mode",
+			query: func(db *gorm.DB) *gorm.DB { return db.Joins(rawJoin) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestFieldDBManager(t, func(config *FieldDBConfig) {
+				config.StrictMode = tt.strict
+			})
+			db, err := manager.GetDB(WithTenant(context.Background(), "tenant-a"))
+			if err != nil {
+				t.Fatalf("GetDB() error = %v", err)
+			}
+
+			var accounts []testFieldAccount
+			if err := tt.query(db).Find(&accounts).Error; !errors.Is(err, tt.wantErr) {
+				t.Errorf("Find() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFieldDBManager_ResolvedTenant(t *testing.T) {
+	manager := newTestFieldDBManager(t)
+	manager.config.StrictMode = true
+	seedFieldUsers(t, manager)
+
+	type headerKey struct{}
+	resolver := tools.DefaultTenantResolver()
+	resolver.AppendExtractor(func(ctx context.Context) (string, bool) {
+		tenantID, ok := ctx.Value(headerKey{}).(string)
+		return tenantID, ok
+	})
+	t.Cleanup(func() {
+		resolver.SetExtractors(tools.MetainfoTenantExtractor, tools.ContextValueTenantExtractor)
+	})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{name: "tools.WithTenant", ctx: tools.WithTenant(context.Background(), "tenant-a")},
+		{name: "context value", ctx: context.WithValue(context.Background(), consts.TenantID, "tenant-a")},
+		{name: "custom extractor", ctx: context.WithValue(context.Background(), headerKey{}, "tenant-a")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := manager.GetDB(tt.ctx)
+			if err != nil {
+				t.Fatalf("GetDB() error = %v", err)
+			}
+			var users []testFieldUser
+			if err := db.Find(&users).Error; err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			if len(users) != 1 || users[0].Name != "Alice" {
+				t.Errorf("Find() = %+v, want only Alice", users)
+			}
+		})
+	}
+}
+
+func TestFieldDBManager_Associations(t *testing.T) {
+	manager := newTestFieldDBManager(t)
+
+	// 租户A的账号引用了租户B的公司和订单
+	companyB := testFieldCompany{Name: "B Corp", TenantID: "tenant-b"}
+	if err := manager.db.Create(&companyB).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	account := testFieldAccount{Name: "Alice", TenantID: "tenant-a", CompanyID: companyB.ID}
+	if err := manager.db.Omit("Company").Create(&account).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	orders := []testFieldOrder{
+		{AccountID: account.ID, Item: "own", TenantID: "tenant-a"},
+		{AccountID: account.ID, Item: "foreign", TenantID: "tenant-b"},
+	}
+	if err := manager.db.Create(&orders).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	db, err := manager.GetDB(WithTenant(context.Background(), "tenant-a"))
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+
+	var preloaded testFieldAccount
+	if err := db.Preload("Company").Preload("Orders").First(&preloaded, account.ID).Error; err != nil {
+		t.Fatalf("Preload() error = %v", err)
+	}
+	if preloaded.Company.ID != 0 {
+		t.Errorf("Preload() Company = %v, want none", preloaded.Company.Name)
+	}
+	if len(preloaded.Orders) != 1 || preloaded.Orders[0].Item != "own" {
+		t.Errorf("Preload() Orders = %v, want only own order", preloaded.Orders)
+	}
+
+	var joined testFieldAccount
+	if err := db.Joins("Company").First(&joined, account.ID).Error; err != nil {
+		t.Fatalf("Joins() error = %v", err)
+	}
+	if joined.Company.ID != 0 {
+		t.Errorf("Joins() Company = %v, want none", joined.Company.Name)
+	}
+
+	var found []testFieldOrder
+	if err := db.Model(&account).Association("Orders").Find(&found); err != nil {
+		t.Fatalf("Association().Find() error = %v", err)
+	}
+	if len(found) != 1 {
+		t.Errorf("Association().Find() = %v orders, want %v", len(found), 1)
+	}
+}
+
+func TestFieldDBManager_NestedCreate(t *testing.T) {
+	manager := newTestFieldDBManager(t)
+
+	db, err := manager.GetDB(WithTenant(context.Background(), "tenant-a"))
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+
+	account := testFieldAccount{
+		Name:    "Alice",
+		Company: testFieldCompany{Name: "A Corp", TenantID: "tenant-b"},
+		Orders:  []testFieldOrder{{Item: "first"}, {Item: "second"}},
+	}
+	if err := db.Create(&account).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := db.Model(&account).Association("Orders").Append(&testFieldOrder{Item: "third"}); err != nil {
+		t.Fatalf("Association().Append() error = %v", err)
+	}
+	users := []testFieldUser{{Name: "Bob"}, {Name: "Carol"}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	sqlDB, err := manager.db.DB()
+	if err != nil {
+		t.Fatalf("DB() error = %v", err)
+	}
+	for table, want := range map[string]int{
+		"test_field_accounts":  1,
+		"test_field_companies": 1,
+		"test_field_orders":    3,
+		"test_field_users":     2,
+	} {
+		var count int
+		if err := sqlDB.QueryRow("SELECT count(*) FROM "+table+" WHERE tenant_id = ?", "tenant-a").Scan(&count); err != nil {
+			t.Fatalf("QueryRow() error = %v", err)
+		}
+		if count != want {
+			t.Errorf("%s tenant-a rows = %v, want %v", table, count, want)
+		}
+	}
+}
+
+func TestFieldDBManager_Scopes(t *testing.T) {
+	manager := newTestFieldDBManager(t, func(config *FieldDBConfig) {
+		config.StrictMode = true
+		config.Scopes = []ScopeColumn{{Field: "org_id"}}
+		config.WidenPermission = func(ctx context.Context) bool {
+			role, _ := GetScopeFromContext(ctx, "role")
+			return role == "admin"
+		}
+	})
+
+	items := []testFieldItem{
+		{Name: "a1", TenantID: "tenant-a", OrgID: "org-1"},
+		{Name: "a2", TenantID: "tenant-a", OrgID: "org-2"},
+		{Name: "b1", TenantID: "tenant-b", OrgID: "org-1"},
+	}
+	if err := manager.db.Create(&items).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	tenantCtx := WithTenant(context.Background(), "tenant-a")
+	orgCtx := WithScope(tenantCtx, "org_id", "org-1")
+	adminCtx := WithScope(WidenToTenant(tenantCtx), "role", "admin")
+
+	db, err := manager.GetDB(orgCtx)
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	item := testFieldItem{Name: "a3"}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if item.TenantID != "tenant-a" || item.OrgID != "org-1" {
+		t.Errorf("Create() scope = %v/%v, want %v/%v", item.TenantID, item.OrgID, "tenant-a", "org-1")
+	}
+	if err := db.Model(&item).Update("org_id", "org-2").Error; !errors.Is(err, ErrTenantFieldChanged) {
+		t.Errorf("Update() error = %v, want %v", err, ErrTenantFieldChanged)
+	}
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		wantErr   error
+		wantItems int
+	}{
+		{name: "organization", ctx: orgCtx, wantItems: 2},
+		{name: "missing organization", ctx: tenantCtx, wantErr: ErrMissingScope},
+		{name: "widen without permission", ctx: WidenToTenant(tenantCtx), wantErr: ErrScopeWidenDenied},
+		{name: "widen with permission", ctx: adminCtx, wantItems: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := manager.GetDB(tt.ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetDB() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			var found []testFieldItem
+			if err := db.Find(&found).Error; err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			if len(found) != tt.wantItems {
+				t.Errorf("Find() = %v items, want %v", len(found), tt.wantItems)
+			}
+		})
+	}
+}
@@ -0,0 +1,579 @@
+package tenant
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Migration 版本化迁移步骤
+type Migration struct {
+	// 版本号，按数值升序执行，推荐使用时间戳，如20240101120000
+	Version int64
+
+	// 迁移名称，仅用于记录和展示
+	Name string
+
+	// 升级函数
+	Up func(tx *gorm.DB) error
+
+	// 回滚函数，为nil时该迁移不可回滚
+	Down func(tx *gorm.DB) error
+}
+
+// MigrationRegistry 迁移注册表，按版本号有序保存所有迁移步骤
+type MigrationRegistry struct {
+	mutex      sync.RWMutex
+	migrations []*Migration
+}
+
+// NewMigrationRegistry 创建迁移注册表
+func NewMigrationRegistry(migrations ...*Migration) (*MigrationRegistry, error) {
+	registry := &MigrationRegistry{}
+	if err := registry.Register(migrations...); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// Register 注册迁移步骤，版本号不能重复
+func (r *MigrationRegistry) Register(migrations ...*Migration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, migration := range migrations {
+		if migration == nil || migration.Up == nil {
+			return fmt.Errorf("migration must have an Up function")
+		}
+		if migration.Version <= 0 {
+			return fmt.Errorf("migration %q must have a positive version", migration.Name)
+		}
+		for _, existing := range r.migrations {
+			if existing.Version == migration.Version {
+				return fmt.Errorf("duplicate migration version %d", migration.Version)
+			}
+		}
+		r.migrations = append(r.migrations, migration)
+	}
+
+	sort.Slice(r.migrations, func(i, j int) bool {
+		return r.migrations[i].Version < r.migrations[j].Version
+	})
+	return nil
+}
+
+// Migrations 获取按版本号排序的迁移步骤
+func (r *MigrationRegistry) Migrations() []*Migration {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return append([]*Migration(nil), r.migrations...)
+}
+
+// LatestVersion 获取最新的迁移版本号，没有迁移时返回0
+func (r *MigrationRegistry) LatestVersion() int64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if len(r.migrations) == 0 {
+		return 0
+	}
+	return r.migrations[len(r.migrations)-1].Version
+}
+
+// SchemaMigration 已执行的迁移记录
+type SchemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+// TableName 迁移记录表名
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// SchemaMigrationLock 迁移锁，防止多个服务实例同时迁移同一数据库
+type SchemaMigrationLock struct {
+	ID        int    `gorm:"primaryKey;autoIncrement:false"`
+	Owner     string `gorm:"size:128"`
+	LockedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// TableName 迁移锁表名
+func (SchemaMigrationLock) TableName() string {
+	return "schema_migration_locks"
+}
+
+// migrationLockID 迁移锁记录的固定主键
+const migrationLockID = 1
+
+// ErrMigrationLockLost 迁移锁已过期并被其他实例接管
+var ErrMigrationLockLost = errors.New("migration lock lost")
+
+// MigrationStatus 单个迁移步骤的执行状态
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// MigratorConfig 迁移引擎配置
+type MigratorConfig struct {
+	// 迁移锁的持有时间，超时后其他实例可以接管
+	// 持有期间每隔LockTTL/3续期一次，每个迁移步骤执行前也会确认仍持有锁
+	// 默认值: 10 * time.Minute
+	LockTTL time.Duration
+
+	// 等待迁移锁的最长时间
+	// 默认值: 1 * time.Minute
+	LockTimeout time.Duration
+
+	// 等待迁移锁时的轮询间隔
+	// 默认值: 500 * time.Millisecond
+	LockPollInterval time.Duration
+
+	// 锁持有者标识
+	// 默认值: 主机名-进程号-随机串
+	Owner string
+}
+
+// NewDefaultMigratorConfig 创建带有默认值的迁移引擎配置
+func NewDefaultMigratorConfig() *MigratorConfig {
+	return &MigratorConfig{
+		LockTTL:          10 * time.Minute,
+		LockTimeout:      time.Minute,
+		LockPollInterval: 500 * time.Millisecond,
+		Owner:            defaultLockOwner(),
+	}
+}
+
+// defaultLockOwner 生成默认的锁持有者标识
+func defaultLockOwner() string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// Migrator 版本化迁移引擎
+// 在每个数据库中使用schema_migrations表记录已执行的迁移
+type Migrator struct {
+	registry *MigrationRegistry
+	config   *MigratorConfig
+}
+
+// NewMigrator 创建迁移引擎
+func NewMigrator(registry *MigrationRegistry, config *MigratorConfig) *Migrator {
+	if registry == nil {
+		registry = &MigrationRegistry{}
+	}
+
+	defaultConfig := NewDefaultMigratorConfig()
+	if config == nil {
+		config = defaultConfig
+	} else {
+		if config.LockTTL <= 0 {
+			config.LockTTL = defaultConfig.LockTTL
+		}
+		if config.LockTimeout <= 0 {
+			config.LockTimeout = defaultConfig.LockTimeout
+		}
+		if config.LockPollInterval <= 0 {
+			config.LockPollInterval = defaultConfig.LockPollInterval
+		}
+		if config.Owner == "" {
+			config.Owner = defaultConfig.Owner
+		}
+	}
+
+	return &Migrator{
+		registry: registry,
+		config:   config,
+	}
+}
+
+// Registry 获取迁移注册表
+func (m *Migrator) Registry() *MigrationRegistry {
+	return m.registry
+}
+
+// primary 迁移记录和迁移锁都在主库上读写
+// 配置了只读副本时查询默认路由到副本，延迟的副本会读到过期的迁移记录，导致已执行的迁移被重复执行
+func (m *Migrator) primary(ctx context.Context, db *gorm.DB) *gorm.DB {
+	return UsePrimary(db.WithContext(ctx)).Session(&gorm.Session{})
+}
+
+// ensureTables 创建迁移记录表和迁移锁表
+func (m *Migrator) ensureTables(db *gorm.DB) error {
+	if err := db.AutoMigrate(&SchemaMigration{}, &SchemaMigrationLock{}); err != nil {
+		return fmt.Errorf("failed to create migration tables: %w", err)
+	}
+	return nil
+}
+
+// appliedVersions 获取已执行的迁移记录
+// 迁移记录表不存在时视为没有执行过任何迁移，不会创建表
+func (m *Migrator) appliedVersions(db *gorm.DB) (map[int64]SchemaMigration, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return map[int64]SchemaMigration{}, nil
+	}
+
+	var records []SchemaMigration
+	if err := db.Order("version").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load applied migrations: %w", err)
+	}
+
+	applied := make(map[int64]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// Status 获取所有迁移步骤在该数据库中的执行状态
+func (m *Migrator) Status(ctx context.Context, db *gorm.DB) ([]MigrationStatus, error) {
+	db = m.primary(ctx, db)
+	applied, err := m.appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := m.registry.Migrations()
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending 获取尚未执行的迁移步骤
+func (m *Migrator) Pending(ctx context.Context, db *gorm.DB) ([]*Migration, error) {
+	db = m.primary(ctx, db)
+	applied, err := m.appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*Migration
+	for _, migration := range m.registry.Migrations() {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up 执行所有未执行的迁移步骤，返回本次执行的迁移
+func (m *Migrator) Up(ctx context.Context, db *gorm.DB) ([]*Migration, error) {
+	db = m.primary(ctx, db)
+	if err := m.ensureTables(db); err != nil {
+		return nil, err
+	}
+
+	if err := m.acquireLock(ctx, db); err != nil {
+		return nil, err
+	}
+	defer m.releaseLock(db)
+	defer m.keepLock(db)()
+
+	// 获取锁后重新读取，其他实例可能已完成迁移
+	applied, err := m.appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*Migration
+	for _, migration := range m.registry.Migrations() {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := m.renewLock(db); err != nil {
+			return done, err
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to apply migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down 按版本号倒序回滚最近执行的steps个迁移步骤，返回本次回滚的迁移
+func (m *Migrator) Down(ctx context.Context, db *gorm.DB, steps int) ([]*Migration, error) {
+	db = m.primary(ctx, db)
+	if err := m.ensureTables(db); err != nil {
+		return nil, err
+	}
+
+	if err := m.acquireLock(ctx, db); err != nil {
+		return nil, err
+	}
+	defer m.releaseLock(db)
+	defer m.keepLock(db)()
+
+	applied, err := m.appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := m.registry.Migrations()
+	var done []*Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return done, fmt.Errorf("migration %d (%s) cannot be rolled back", migration.Version, migration.Name)
+		}
+		if err := m.renewLock(db); err != nil {
+			return done, err
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to roll back migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// acquireLock 获取迁移锁，等待时间受LockTimeout和ctx控制
+func (m *Migrator) acquireLock(ctx context.Context, db *gorm.DB) error {
+	deadline := time.Now().Add(m.config.LockTimeout)
+
+	for {
+		now := time.Now()
+		// 清理已过期的锁
+		if err := db.Where("id = ? AND expires_at < ?", migrationLockID, now).
+			Delete(&SchemaMigrationLock{}).Error; err != nil {
+			return fmt.Errorf("failed to clean expired migration lock: %w", err)
+		}
+
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&SchemaMigrationLock{
+			ID:        migrationLockID,
+			Owner:     m.config.Owner,
+			LockedAt:  now,
+			ExpiresAt: now.Add(m.config.LockTTL),
+		})
+		if result.Error != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			return nil
+		}
+
+		if now.After(deadline) {
+			return fmt.Errorf("timed out waiting for migration lock")
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for migration lock: %w", ctx.Err())
+		case <-time.After(m.config.LockPollInterval):
+		}
+	}
+}
+
+// renewLock 确认仍持有迁移锁并延长过期时间
+func (m *Migrator) renewLock(db *gorm.DB) error {
+	result := db.Model(&SchemaMigrationLock{}).
+		Where("id = ? AND owner = ?", migrationLockID, m.config.Owner).
+		Update("expires_at", time.Now().Add(m.config.LockTTL))
+	if result.Error != nil {
+		return fmt.Errorf("failed to renew migration lock: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrMigrationLockLost
+	}
+	return nil
+}
+
+// keepLock 在后台定期续期迁移锁，直到返回的函数被调用
+// 单个迁移步骤耗时超过LockTTL时，锁不会因过期被其他实例接管
+func (m *Migrator) keepLock(db *gorm.DB) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(m.config.LockTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// 续期失败时由下一个迁移步骤前的检查中止迁移
+				if err := m.renewLock(db); err != nil {
+					klog.Warnf("renew migration lock failed: %v", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// releaseLock 释放迁移锁
+func (m *Migrator) releaseLock(db *gorm.DB) {
+	// 使用独立的上下文，避免调用方取消后锁无法释放
+	db.WithContext(context.Background()).
+		Where("id = ? AND owner = ?", migrationLockID, m.config.Owner).
+		Delete(&SchemaMigrationLock{})
+}
+
+// SetMigrator 设置版本化迁移引擎
+func (m *TenantDBManager) SetMigrator(migrator *Migrator) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.config.Migrator = migrator
+}
+
+// getMigrator 获取版本化迁移引擎，未配置时返回错误
+func (m *TenantDBManager) getMigrator() (*Migrator, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.config.Migrator == nil {
+		return nil, fmt.Errorf("migrator is not configured")
+	}
+	return m.config.Migrator, nil
+}
+
+// MigrationStatus 获取租户库的迁移状态
+func (m *TenantDBManager) MigrationStatus(ctx context.Context, tenantID string) ([]MigrationStatus, error) {
+	migrator, err := m.getMigrator()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := m.GetDBContext(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.Status(ctx, db)
+}
+
+// Migrate 对租户库执行所有未执行的迁移
+func (m *TenantDBManager) Migrate(ctx context.Context, tenantID string) ([]*Migration, error) {
+	migrator, err := m.getMigrator()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := m.GetDBContext(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.Up(ctx, db)
+}
+
+// Rollback 回滚租户库最近执行的steps个迁移
+func (m *TenantDBManager) Rollback(ctx context.Context, tenantID string, steps int) ([]*Migration, error) {
+	migrator, err := m.getMigrator()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := m.GetDBContext(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.Down(ctx, db, steps)
+}
+
+// SetMigrator 设置版本化迁移引擎
+func (m *FieldDBManager) SetMigrator(migrator *Migrator) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.config.Migrator = migrator
+}
+
+// migratorAndDB 获取版本化迁移引擎和共享数据库连接
+func (m *FieldDBManager) migratorAndDB() (*Migrator, *gorm.DB, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.config.Migrator == nil {
+		return nil, nil, fmt.Errorf("migrator is not configured")
+	}
+	if m.db == nil {
+		return nil, nil, fmt.Errorf("database not connected, call Connect() first")
+	}
+	return m.config.Migrator, m.db, nil
+}
+
+// MigrationStatus 获取共享数据库的迁移状态
+func (m *FieldDBManager) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrator, db, err := m.migratorAndDB()
+	if err != nil {
+		return nil, err
+	}
+	return migrator.Status(ctx, db)
+}
+
+// Migrate 对共享数据库执行所有未执行的迁移
+func (m *FieldDBManager) Migrate(ctx context.Context) ([]*Migration, error) {
+	migrator, db, err := m.migratorAndDB()
+	if err != nil {
+		return nil, err
+	}
+	return migrator.Up(ctx, db)
+}
+
+// Rollback 回滚共享数据库最近执行的steps个迁移
+func (m *FieldDBManager) Rollback(ctx context.Context, steps int) ([]*Migration, error) {
+	migrator, db, err := m.migratorAndDB()
+	if err != nil {
+		return nil, err
+	}
+	return migrator.Down(ctx, db, steps)
+}
@@ -0,0 +1,291 @@
+package tenant
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TenantSource 租户来源，提供当前所有租户及其DSN
+type TenantSource interface {
+	// LoadTenants 加载所有租户，键为租户ID，值为DSN
+	LoadTenants(ctx context.Context) (map[string]string, error)
+}
+
+// FleetMigrateOptions 全量租户迁移选项
+type FleetMigrateOptions struct {
+	// 并发迁移的租户数量
+	// 默认值: 4
+	Concurrency int
+
+	// 仅报告待执行的迁移，不实际执行
+	// 默认值: false
+	DryRun bool
+
+	// 任一租户迁移失败后停止，尚未开始的租户标记为跳过
+	// 默认值: false
+	StopOnFailure bool
+
+	// 仅迁移指定的租户，为空时迁移所有已知租户
+	// 默认值: nil
+	Tenants []string
+
+	// 租户来源，加载到的DSN会注册到管理器
+	// 默认值: nil (使用DBConfig.TenantDSNs)
+	Source TenantSource
+}
+
+// TenantMigrateResult 单个租户的迁移结果
+type TenantMigrateResult struct {
+	TenantID string
+
+	// 待执行（DryRun）或本次已执行的迁移
+	Migrations []*Migration
+
+	// 是否因StopOnFailure而跳过
+	Skipped bool
+
+	Err      error
+	Duration time.Duration
+}
+
+// FleetMigrateReport 全量租户迁移报告
+type FleetMigrateReport struct {
+	DryRun    bool
+	Results   []TenantMigrateResult
+	Succeeded int
+	Failed    int
+	Skipped   int
+}
+
+// HasFailures 是否存在迁移失败的租户
+func (r *FleetMigrateReport) HasFailures() bool {
+	return r.Failed > 0
+}
+
+// Print 以表格形式输出迁移报告
+func (r *FleetMigrateReport) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TENANT\tSTATUS\tMIGRATIONS\tDURATION\tERROR")
+	for _, result := range r.Results {
+		status := "ok"
+		switch {
+		case result.Skipped:
+			status = "skipped"
+		case result.Err != nil:
+			status = "failed"
+		case r.DryRun && len(result.Migrations) > 0:
+			status = "pending"
+		}
+
+		versions := make([]string, 0, len(result.Migrations))
+		for _, migration := range result.Migrations {
+			versions = append(versions, fmt.Sprintf("%d", migration.Version))
+		}
+
+		errMsg := ""
+		if result.Err != nil {
+			errMsg = result.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			result.TenantID, status, strings.Join(versions, ","), result.Duration.Round(time.Millisecond), errMsg)
+	}
+	_ = tw.Flush()
+
+	fmt.Fprintf(w, "succeeded: %d, failed: %d, skipped: %d\n", r.Succeeded, r.Failed, r.Skipped)
+}
+
+// ListTenants 获取所有已知租户ID，不包含默认库
+// source不为nil时从租户来源加载并注册DSN，否则使用已配置的TenantDSNs
+func (m *TenantDBManager) ListTenants(ctx context.Context, source TenantSource) ([]string, error) {
+	if source != nil {
+		dsns, err := source.LoadTenants(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tenants: %w", err)
+		}
+		for tenantID, dsn := range dsns {
+			m.RegisterTenant(tenantID, dsn)
+		}
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	tenants := make([]string, 0, len(m.config.TenantDSNs))
+	for tenantID := range m.config.TenantDSNs {
+		if tenantID != "" {
+			tenants = append(tenants, tenantID)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// MigrateAll 以有限并发对所有租户执行版本化迁移，并返回每个租户的结果
+// 未打开的租户使用临时连接，迁移后立即关闭，不占用连接池缓存
+func (m *TenantDBManager) MigrateAll(ctx context.Context, opts *FleetMigrateOptions) (*FleetMigrateReport, error) {
+	if opts == nil {
+		opts = &FleetMigrateOptions{}
+	}
+
+	migrator, err := m.getMigrator()
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := opts.Tenants
+	if len(tenants) == 0 {
+		if tenants, err = m.ListTenants(ctx, opts.Source); err != nil {
+			return nil, err
+		}
+	} else if opts.Source != nil {
+		if _, err = m.ListTenants(ctx, opts.Source); err != nil {
+			return nil, err
+		}
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]TenantMigrateResult, len(tenants))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				results[idx] = m.migrateTenant(runCtx, migrator, tenants[idx], opts.DryRun)
+				if results[idx].Err != nil && opts.StopOnFailure {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for idx, tenantID := range tenants {
+		if runCtx.Err() != nil {
+			results[idx] = TenantMigrateResult{TenantID: tenantID, Skipped: true}
+			continue
+		}
+		select {
+		case jobs <- idx:
+		case <-runCtx.Done():
+			results[idx] = TenantMigrateResult{TenantID: tenantID, Skipped: true}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	report := &FleetMigrateReport{DryRun: opts.DryRun, Results: results}
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+			report.Skipped++
+		case result.Err != nil:
+			report.Failed++
+		default:
+			report.Succeeded++
+		}
+	}
+	return report, nil
+}
+
+// migrateTenant 迁移单个租户
+func (m *TenantDBManager) migrateTenant(ctx context.Context, migrator *Migrator, tenantID string, dryRun bool) TenantMigrateResult {
+	start := time.Now()
+	result := TenantMigrateResult{TenantID: tenantID}
+
+	// DryRun时不自动创建数据库
+	result.Err = m.withTenantConn(tenantID, !dryRun, func(db *gorm.DB) error {
+		var err error
+		if dryRun {
+			result.Migrations, err = migrator.Pending(ctx, db)
+		} else {
+			result.Migrations, err = migrator.Up(ctx, db)
+		}
+		return err
+	})
+	result.Duration = time.Since(start)
+	return result
+}
+
+// withTenantConn 使用租户连接执行fn
+// 租户连接已打开时直接复用，否则使用临时连接并在执行后关闭
+func (m *TenantDBManager) withTenantConn(tenantID string, autoCreate bool, fn func(db *gorm.DB) error) error {
+	m.mutex.RLock()
+	db, exists := m.lookupDB(tenantID)
+	dsn, err := m.resolveDSN(tenantID)
+	m.mutex.RUnlock()
+
+	if exists {
+		return fn(db)
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err = m.connect(tenantID, dsn, autoCreate)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	return fn(db)
+}
+
+// RunMigrateCommand 解析命令行参数并执行全量租户迁移，返回进程退出码
+// 供服务在自己的main中嵌入使用，支持的参数：
+//
+//	-dry-run        仅报告待执行的迁移
+//	-concurrency N  并发迁移的租户数量
+//	-fail-fast      任一租户失败后停止
+//	-tenants a,b    仅迁移指定的租户
+func RunMigrateCommand(ctx context.Context, m *TenantDBManager, source TenantSource, args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dryRun := fs.Bool("dry-run", false, "only report pending migrations")
+	concurrency := fs.Int("concurrency", 4, "number of tenants migrated concurrently")
+	failFast := fs.Bool("fail-fast", false, "stop after the first failed tenant")
+	tenantList := fs.String("tenants", "", "comma separated tenant IDs, empty for all tenants")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := &FleetMigrateOptions{
+		Concurrency:   *concurrency,
+		DryRun:        *dryRun,
+		StopOnFailure: *failFast,
+		Source:        source,
+	}
+	for _, tenantID := range strings.Split(*tenantList, ",") {
+		if tenantID = strings.TrimSpace(tenantID); tenantID != "" {
+			opts.Tenants = append(opts.Tenants, tenantID)
+		}
+	}
+
+	report, err := m.MigrateAll(ctx, opts)
+	if err != nil {
+		fmt.Fprintf(out, "migrate failed: %v\n", err)
+		return 1
+	}
+
+	report.Print(out)
+	if report.HasFailures() {
+		return 1
+	}
+	return 0
+}
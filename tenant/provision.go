@@ -0,0 +1,275 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrTenantExists 开通的租户已注册DSN
+var ErrTenantExists = errors.New("tenant already has a DSN")
+
+// TenantHook 租户生命周期钩子，可用于清理Redis键、配置等外部资源
+type TenantHook func(ctx context.Context, tenantID string) error
+
+// ProvisionOptions 租户开通选项
+type ProvisionOptions struct {
+	// 租户DSN
+	// 默认值: 空字符串 (使用DSNTemplate生成)
+	DSN string
+
+	// 初始化数据，在迁移完成后执行
+	// 默认值: nil
+	Seed func(ctx context.Context, db *gorm.DB) error
+
+	// 开通前执行的钩子，任一钩子失败则中止开通
+	PreHooks []TenantHook
+
+	// 开通完成后执行的钩子
+	PostHooks []TenantHook
+}
+
+// DeprovisionMode 租户注销后的数据库处理方式
+type DeprovisionMode int
+
+const (
+	// DeprovisionArchive 重命名数据库以归档
+	DeprovisionArchive DeprovisionMode = iota
+	// DeprovisionDrop 删除数据库
+	DeprovisionDrop
+	// DeprovisionKeep 仅关闭连接池并移除注册，保留数据库
+	DeprovisionKeep
+)
+
+// DeprovisionOptions 租户注销选项
+type DeprovisionOptions struct {
+	// 数据库处理方式
+	// 默认值: DeprovisionArchive
+	Mode DeprovisionMode
+
+	// 归档后的数据库名称
+	// 默认值: 原库名_archived_时间戳
+	ArchiveName string
+
+	// 注销前执行的钩子，任一钩子失败则中止注销
+	PreHooks []TenantHook
+
+	// 注销完成后执行的钩子
+	PostHooks []TenantHook
+}
+
+// DeprovisionResult 租户注销结果
+type DeprovisionResult struct {
+	TenantID string
+	Mode     DeprovisionMode
+
+	// 归档后的数据库名称，仅DeprovisionArchive时有值
+	ArchivedAs string
+}
+
+// runHooks 依次执行钩子
+func runHooks(ctx context.Context, tenantID string, hooks []TenantHook) error {
+	for _, hook := range hooks {
+		if err := hook(ctx, tenantID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProvisionTenant 开通租户：创建数据库、执行迁移、初始化数据并注册DSN
+// 迁移和初始化数据使用临时连接，全部成功后才注册DSN，开通期间其他调用方无法访问未完成开通的租户
+// 租户已注册DSN时返回ErrTenantExists，不会覆盖已有的注册
+func (m *TenantDBManager) ProvisionTenant(ctx context.Context, tenantID string, opts *ProvisionOptions) (*gorm.DB, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant ID cannot be empty")
+	}
+	if opts == nil {
+		opts = &ProvisionOptions{}
+	}
+
+	m.mutex.RLock()
+	_, exists := m.config.TenantDSNs[tenantID]
+	migrateFunc := m.config.MigrateFunc
+	migrator := m.config.Migrator
+	m.mutex.RUnlock()
+	if exists {
+		return nil, fmt.Errorf("failed to provision tenant %s: %w", tenantID, ErrTenantExists)
+	}
+
+	if err := runHooks(ctx, tenantID, opts.PreHooks); err != nil {
+		return nil, fmt.Errorf("pre-provision hook failed for tenant %s: %w", tenantID, err)
+	}
+
+	dsn := opts.DSN
+	if dsn == "" {
+		if m.config.DSNTemplate == "" {
+			return nil, fmt.Errorf("no DSN configuration found for tenant: %s", tenantID)
+		}
+		dsn = fmt.Sprintf(m.config.DSNTemplate, tenantID)
+	}
+
+	if err := m.config.Dialect.CreateDatabase(dsn, m.config.DefaultCharset, m.config.DefaultCollation); err != nil {
+		return nil, fmt.Errorf("failed to create database for tenant %s: %w", tenantID, err)
+	}
+
+	db, err := m.connect(tenantID, dsn, false)
+	if err != nil {
+		return nil, err
+	}
+	err = m.migrate(ctx, tenantID, db, migrateFunc, migrator)
+	if err == nil && opts.Seed != nil {
+		if seedErr := opts.Seed(ctx, db.WithContext(ctx)); seedErr != nil {
+			err = fmt.Errorf("failed to seed database for tenant %s: %w", tenantID, seedErr)
+		}
+	}
+	if err == nil {
+		err = m.registerProvisioned(tenantID, dsn, db)
+	}
+	if err != nil {
+		// 开通失败时不注册租户，保留已创建的数据库以便排查
+		closeDB(db)
+		return nil, err
+	}
+
+	if err := runHooks(ctx, tenantID, opts.PostHooks); err != nil {
+		return db, fmt.Errorf("post-provision hook failed for tenant %s: %w", tenantID, err)
+	}
+	return db, nil
+}
+
+// registerProvisioned 注册开通完成的租户DSN，并缓存开通时使用的连接池
+// 开通期间其他调用方注册了该租户时返回ErrTenantExists
+func (m *TenantDBManager) registerProvisioned(tenantID, dsn string, db *gorm.DB) error {
+	m.mutex.Lock()
+	if _, exists := m.config.TenantDSNs[tenantID]; exists {
+		m.mutex.Unlock()
+		return fmt.Errorf("failed to provision tenant %s: %w", tenantID, ErrTenantExists)
+	}
+	m.config.TenantDSNs[tenantID] = dsn
+	m.generations[tenantID]++
+	delete(m.failures, tenantID)
+	delete(m.deprovisioned, tenantID)
+
+	// 之前通过DSNTemplate打开的连接池可能仍在使用，宽限期后关闭
+	var previous *tenantDBEntry
+	if elem, ok := m.dbs[tenantID]; ok {
+		previous = m.removeEntry(elem)
+	}
+	evicted := m.storeDB(tenantID, db)
+	m.mutex.Unlock()
+
+	if previous != nil {
+		m.retireDB(previous.db)
+	}
+	m.closeEvicted(evicted)
+	return nil
+}
+
+// DeprovisionTenant 注销租户：关闭连接池、移除注册，并删除或归档数据库
+// 注销后通过DSNTemplate也无法再访问该租户，需重新RegisterTenant或ProvisionTenant
+func (m *TenantDBManager) DeprovisionTenant(ctx context.Context, tenantID string, opts *DeprovisionOptions) (*DeprovisionResult, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant ID cannot be empty")
+	}
+	if opts == nil {
+		opts = &DeprovisionOptions{}
+	}
+	switch opts.Mode {
+	case DeprovisionArchive, DeprovisionDrop, DeprovisionKeep:
+	default:
+		return nil, fmt.Errorf("unknown deprovision mode %d", opts.Mode)
+	}
+
+	if err := runHooks(ctx, tenantID, opts.PreHooks); err != nil {
+		return nil, fmt.Errorf("pre-deprovision hook failed for tenant %s: %w", tenantID, err)
+	}
+
+	// 处理数据库期间阻止新连接，连接池需先关闭才能重命名或删除
+	m.mutex.Lock()
+	dsn, err := m.resolveDSN(tenantID)
+	if err == nil {
+		m.deprovisioned[tenantID] = struct{}{}
+		m.generations[tenantID]++
+	}
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	m.closeTenantDB(tenantID)
+
+	result := &DeprovisionResult{TenantID: tenantID, Mode: opts.Mode}
+	dialect := m.config.Dialect
+	switch opts.Mode {
+	case DeprovisionDrop:
+		err = dialect.DropDatabase(dsn)
+		if err != nil {
+			err = fmt.Errorf("failed to drop database for tenant %s: %w", tenantID, err)
+		}
+	case DeprovisionArchive:
+		archiveName := opts.ArchiveName
+		if archiveName == "" {
+			// SQLite的数据库名称是文件路径，归档名只取文件名，重命名到同目录下
+			archiveName = fmt.Sprintf("%s_archived_%s", filepath.Base(dialect.DatabaseName(dsn)), time.Now().Format("20060102150405"))
+		}
+		err = dialect.RenameDatabase(dsn, archiveName)
+		if err != nil {
+			err = fmt.Errorf("failed to archive database for tenant %s: %w", tenantID, err)
+		}
+		result.ArchivedAs = archiveName
+	}
+	if err != nil {
+		// 数据库未变更，恢复租户访问
+		m.mutex.Lock()
+		delete(m.deprovisioned, tenantID)
+		m.mutex.Unlock()
+		return nil, err
+	}
+
+	m.unregisterTenant(tenantID)
+
+	if err := runHooks(ctx, tenantID, opts.PostHooks); err != nil {
+		return result, fmt.Errorf("post-deprovision hook failed for tenant %s: %w", tenantID, err)
+	}
+	return result, nil
+}
+
+// closeTenantDB 关闭租户连接池，保留注册信息
+func (m *TenantDBManager) closeTenantDB(tenantID string) {
+	m.mutex.Lock()
+	var entry *tenantDBEntry
+	if elem, ok := m.dbs[tenantID]; ok {
+		entry = m.removeEntry(elem)
+	}
+	m.mutex.Unlock()
+
+	if entry != nil {
+		closeDB(entry.db)
+	}
+}
+
+// unregisterTenant 关闭租户连接池并移除注册信息
+func (m *TenantDBManager) unregisterTenant(tenantID string) {
+	m.mutex.Lock()
+	delete(m.config.TenantDSNs, tenantID)
+	delete(m.config.TenantReplicaDSNs, tenantID)
+	delete(m.config.TenantPools, tenantID)
+	delete(m.failures, tenantID)
+	delete(m.sourced, tenantID)
+	m.deprovisioned[tenantID] = struct{}{}
+	m.generations[tenantID]++
+
+	var entry *tenantDBEntry
+	if elem, ok := m.dbs[tenantID]; ok {
+		entry = m.removeEntry(elem)
+	}
+	m.mutex.Unlock()
+
+	if entry != nil {
+		closeDB(entry.db)
+	}
+}
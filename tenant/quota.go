@@ -0,0 +1,374 @@
+package tenant
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/onebids/onecommon/consts/errno"
+	"github.com/onebids/onecommon/kvconfig"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// quotaReservedKey 保存已预占配额的语句设置键
+const quotaReservedKey = "tenant:quota_reserved"
+
+// reserveScript 缓存计数存在时检查配额并预占，返回-1表示缓存不存在，0表示超出配额，1表示预占成功
+var reserveScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if not current then
+	return -1
+end
+if tonumber(current) + tonumber(ARGV[1]) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('INCRBY', KEYS[1], ARGV[1])
+return 1
+`)
+
+// releaseScript 缓存计数存在时减少计数
+var releaseScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return redis.call('DECRBY', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// QuotaLimits 租户行数配额，键为表名，值为最大行数
+//
+// Consul中的YAML格式:
+//
+//	default:
+//	  activities: 100
+//	tenants:
+//	  tenant1:
+//	    activities: 1000
+type QuotaLimits struct {
+	// 所有租户的默认配额
+	Default map[string]int64 `yaml:"default"`
+
+	// 租户特定的配额，键为租户ID，覆盖默认配额
+	Tenants map[string]map[string]int64 `yaml:"tenants"`
+}
+
+// Limit 获取租户在表上的配额，未配置时返回false
+func (l *QuotaLimits) Limit(tenantID, table string) (int64, bool) {
+	if l == nil {
+		return 0, false
+	}
+	if limits, ok := l.Tenants[tenantID]; ok {
+		if limit, ok := limits[table]; ok {
+			return limit, true
+		}
+	}
+	limit, ok := l.Default[table]
+	return limit, ok
+}
+
+// LoadQuotaLimits 从Consul KV加载配额配置
+func LoadQuotaLimits(registryAddr, key string) (*QuotaLimits, error) {
+	limits, err := kvconfig.GetKvConfig[QuotaLimits](registryAddr, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load quota limits: %w", err)
+	}
+	return limits, nil
+}
+
+// QuotaConfig 租户配额配置
+type QuotaConfig struct {
+	// 配额
+	// 默认值: nil (不限制)
+	Limits *QuotaLimits
+
+	// 缓存行数的Redis客户端
+	// 默认值: nil (每次创建时查询数据库计数)
+	Redis redis.UniversalClient
+
+	// 行数缓存的过期时间，过期后重新从数据库计数，用于修正事务回滚等造成的偏差
+	// 默认值: 10 * time.Minute
+	CacheTTL time.Duration
+
+	// 行数缓存的key前缀
+	// 默认值: "tenant:quota"
+	KeyPrefix string
+}
+
+// NewDefaultQuotaConfig 创建带有默认值的配额配置
+func NewDefaultQuotaConfig() *QuotaConfig {
+	return &QuotaConfig{
+		CacheTTL:  10 * time.Minute,
+		KeyPrefix: "tenant:quota",
+	}
+}
+
+// TenantQuota 租户行数配额
+// 创建记录前检查租户在该表上的行数，超出配额时返回errno.QuotaExceeded
+type TenantQuota struct {
+	config *QuotaConfig
+	mutex  sync.RWMutex
+	limits *QuotaLimits
+}
+
+// NewTenantQuota 创建租户行数配额
+func NewTenantQuota(config *QuotaConfig) *TenantQuota {
+	if config == nil {
+		config = NewDefaultQuotaConfig()
+	} else {
+		// 填充默认值
+		defaultConfig := NewDefaultQuotaConfig()
+		if config.CacheTTL == 0 {
+			config.CacheTTL = defaultConfig.CacheTTL
+		}
+		if config.KeyPrefix == "" {
+			config.KeyPrefix = defaultConfig.KeyPrefix
+		}
+	}
+
+	return &TenantQuota{
+		config: config,
+		limits: config.Limits,
+	}
+}
+
+// SetLimits 替换配额配置，用于从Consul重新加载
+func (q *TenantQuota) SetLimits(limits *QuotaLimits) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.limits = limits
+}
+
+// limit 获取租户在表上的配额
+func (q *TenantQuota) limit(tenantID, table string) (int64, bool) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	return q.limits.Limit(tenantID, table)
+}
+
+// key 获取行数缓存的key
+func (q *TenantQuota) key(tenantID, table string) string {
+	return fmt.Sprintf("%s:%s:%s", q.config.KeyPrefix, tenantID, table)
+}
+
+// reserve 为即将创建的n条记录预占配额
+func (q *TenantQuota) reserve(db *gorm.DB, tenantID string, n, limit int64) error {
+	ctx := db.Statement.Context
+	table := db.Statement.Table
+	if q.config.Redis == nil {
+		return q.checkCount(db, n, limit)
+	}
+
+	key := q.key(tenantID, table)
+	for attempt := 0; attempt < 2; attempt++ {
+		result, err := reserveScript.Run(ctx, q.config.Redis, []string{key}, n, limit).Int64()
+		if err != nil {
+			klog.CtxWarnf(ctx, "quota cache unavailable, counting from database: %v", err)
+			return q.checkCount(db, n, limit)
+		}
+
+		switch result {
+		case 1:
+			db.InstanceSet(quotaReservedKey, n)
+			return nil
+		case 0:
+			return quotaExceeded(table, limit)
+		}
+
+		// 缓存不存在时从数据库计数并初始化
+		count, err := q.count(db)
+		if err != nil {
+			return err
+		}
+		if err := q.config.Redis.SetNX(ctx, key, count, q.config.CacheTTL).Err(); err != nil {
+			klog.CtxWarnf(ctx, "quota cache unavailable, counting from database: %v", err)
+			return checkQuota(table, count, n, limit)
+		}
+	}
+	return q.checkCount(db, n, limit)
+}
+
+// release 释放预占但未创建成功的配额
+func (q *TenantQuota) release(db *gorm.DB, tenantID string, n int64) {
+	if q.config.Redis == nil || n <= 0 {
+		return
+	}
+
+	ctx := db.Statement.Context
+	if err := releaseScript.Run(ctx, q.config.Redis, []string{q.key(tenantID, db.Statement.Table)}, n).Err(); err != nil {
+		klog.CtxWarnf(ctx, "failed to release quota for tenant %s: %v", tenantID, err)
+	}
+}
+
+// invalidate 删除缓存的行数，下次创建时重新从数据库计数
+func (q *TenantQuota) invalidate(db *gorm.DB, tenantID string) {
+	if q.config.Redis == nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	if err := q.config.Redis.Del(ctx, q.key(tenantID, db.Statement.Table)).Err(); err != nil {
+		klog.CtxWarnf(ctx, "failed to invalidate quota cache for tenant %s: %v", tenantID, err)
+	}
+}
+
+// checkCount 从数据库计数并检查配额
+func (q *TenantQuota) checkCount(db *gorm.DB, n, limit int64) error {
+	count, err := q.count(db)
+	if err != nil {
+		return err
+	}
+	return checkQuota(db.Statement.Table, count, n, limit)
+}
+
+// count 在主库上统计租户在表上的行数，字段级隔离时由TenantPlugin添加租户条件
+func (q *TenantQuota) count(db *gorm.DB) (int64, error) {
+	var count int64
+	err := UsePrimary(db.Session(&gorm.Session{NewDB: true, SkipHooks: true})).
+		Model(reflect.New(db.Statement.Schema.ModelType).Interface()).
+		Table(db.Statement.Table).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count rows for quota: %w", err)
+	}
+	return count, nil
+}
+
+// checkQuota 检查新增n条记录后是否超出配额
+func checkQuota(table string, count, n, limit int64) error {
+	if count+n > limit {
+		return quotaExceeded(table, limit)
+	}
+	return nil
+}
+
+// quotaExceeded 创建超出配额的错误
+func quotaExceeded(table string, limit int64) error {
+	return errno.QuotaExceeded.WithMessage(fmt.Sprintf("quota exceeded for %s: limit %d", table, limit))
+}
+
+// quotaPlugin 配额GORM插件
+type quotaPlugin struct {
+	quota *TenantQuota
+
+	// 数据库级隔离时连接所属的租户，为空时从上下文获取
+	tenantID string
+}
+
+// Name 实现gorm.Plugin接口
+func (p *quotaPlugin) Name() string {
+	return "tenant:quota"
+}
+
+// Initialize 实现gorm.Plugin接口，注册配额回调
+func (p *quotaPlugin) Initialize(db *gorm.DB) error {
+	callbacks := []error{
+		db.Callback().Create().After("tenant:create").Before("gorm:create").Register("quota:reserve", p.beforeCreate),
+		db.Callback().Create().After("gorm:create").Register("quota:release", p.afterCreate),
+		db.Callback().Delete().After("gorm:delete").Register("quota:delete", p.afterDelete),
+	}
+	for _, err := range callbacks {
+		if err != nil {
+			return fmt.Errorf("failed to register quota callback: %w", err)
+		}
+	}
+	return nil
+}
+
+// tenantLimit 获取语句所属的租户及其在表上的配额，跨租户访问和租户迁移不检查配额
+func (p *quotaPlugin) tenantLimit(db *gorm.DB) (string, int64, bool) {
+	if db.Statement.Schema == nil || isDataMove(db) {
+		return "", 0, false
+	}
+
+	tenantID := p.tenantID
+	if tenantID == "" {
+		if _, ok := GetSystemScope(db.Statement.Context); ok {
+			return "", 0, false
+		}
+		tenantID, _ = GetTenantFromContext(db.Statement.Context)
+	}
+	if tenantID == "" {
+		return "", 0, false
+	}
+
+	limit, ok := p.quota.limit(tenantID, db.Statement.Table)
+	return tenantID, limit, ok
+}
+
+// beforeCreate 检查并预占配额
+func (p *quotaPlugin) beforeCreate(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+
+	tenantID, limit, ok := p.tenantLimit(db)
+	if !ok {
+		return
+	}
+
+	if n := countRecords(db.Statement.ReflectValue); n > 0 {
+		_ = db.AddError(p.quota.reserve(db, tenantID, n, limit))
+	}
+}
+
+// afterCreate 释放创建失败或被忽略的记录预占的配额
+func (p *quotaPlugin) afterCreate(db *gorm.DB) {
+	value, ok := db.InstanceGet(quotaReservedKey)
+	if !ok {
+		return
+	}
+	reserved := value.(int64)
+
+	tenantID, _, ok := p.tenantLimit(db)
+	if !ok {
+		return
+	}
+
+	switch {
+	case db.Error != nil:
+		p.quota.release(db, tenantID, reserved)
+	case isUpsert(db):
+		// 冲突时更新的行也计入RowsAffected（MySQL计为2行），无法得知新增的行数，重新从数据库计数
+		p.quota.invalidate(db, tenantID)
+	case db.RowsAffected < reserved:
+		p.quota.release(db, tenantID, reserved-db.RowsAffected)
+	}
+}
+
+// afterDelete 删除记录后减少缓存的行数
+func (p *quotaPlugin) afterDelete(db *gorm.DB) {
+	if db.Error != nil || db.RowsAffected <= 0 {
+		return
+	}
+
+	if tenantID, _, ok := p.tenantLimit(db); ok {
+		p.quota.release(db, tenantID, db.RowsAffected)
+	}
+}
+
+// isUpsert 语句是否在冲突时更新已有记录
+func isUpsert(db *gorm.DB) bool {
+	c, ok := db.Statement.Clauses["ON CONFLICT"]
+	if !ok {
+		return false
+	}
+	onConflict, ok := c.Expression.(clause.OnConflict)
+	return ok && (onConflict.UpdateAll || len(onConflict.DoUpdates) > 0)
+}
+
+// countRecords 统计即将创建的记录数
+func countRecords(value reflect.Value) int64 {
+	value = reflect.Indirect(value)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		return int64(value.Len())
+	case reflect.Struct, reflect.Map:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,219 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/onebids/onecommon/consts/errno"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm/clause"
+)
+
+// isQuotaExceeded 检查错误是否为errno.QuotaExceeded
+func isQuotaExceeded(err error) bool {
+	var errNo errno.ErrNo
+	return errors.As(err, &errNo) && errNo.ErrCode == errno.QuotaExceeded.ErrCode
+}
+
+func TestQuotaLimits_Limit(t *testing.T) {
+	limits := &QuotaLimits{
+		Default: map[string]int64{"orders": 10, "users": 5},
+		Tenants: map[string]map[string]int64{"vip": {"orders": 100}},
+	}
+
+	tests := []struct {
+		name      string
+		limits    *QuotaLimits
+		tenantID  string
+		table     string
+		wantLimit int64
+		wantOK    bool
+	}{
+		{"default", limits, "tenant1", "orders", 10, true},
+		{"tenant override", limits, "vip", "orders", 100, true},
+		{"fallback to default", limits, "vip", "users", 5, true},
+		{"not configured", limits, "tenant1", "items", 0, false},
+		{"nil limits", nil, "tenant1", "orders", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, ok := tt.limits.Limit(tt.tenantID, tt.table)
+			if limit != tt.wantLimit || ok != tt.wantOK {
+				t.Errorf("Limit() = %v, %v, want %v, %v", limit, ok, tt.wantLimit, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTenantQuota_FieldDBManager(t *testing.T) {
+	tests := []struct {
+		name  string
+		redis redis.UniversalClient
+	}{
+		{"database count", nil},
+		{"redis cache", redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})},
+		{"redis unavailable", redis.NewClient(&redis.Options{
+			Addr:        "127.0.0.1:1",
+			DialTimeout: 100 * time.Millisecond,
+			MaxRetries:  -1,
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quota := NewTenantQuota(&QuotaConfig{
+				Limits: &QuotaLimits{
+					Default: map[string]int64{"test_field_users": 2},
+					Tenants: map[string]map[string]int64{"tenant-b": {"test_field_users": 3}},
+				},
+				Redis: tt.redis,
+			})
+			manager := newTestFieldDBManager(t, func(config *FieldDBConfig) {
+				config.Quota = quota
+			})
+
+			ctxA := WithTenant(context.Background(), "tenant-a")
+			db, err := manager.GetDB(ctxA)
+			if err != nil {
+				t.Fatalf("GetDB() error = %v", err)
+			}
+
+			if err := db.Create(&testFieldUser{Name: "a1"}).Error; err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			batch := []testFieldUser{{Name: "a2"}, {Name: "a3"}}
+			if err := db.Create(&batch).Error; !isQuotaExceeded(err) {
+				t.Errorf("Create(batch) error = %v, want %v", err, errno.QuotaExceeded)
+			}
+			user := testFieldUser{Name: "a2"}
+			if err := db.Create(&user).Error; err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if err := db.Create(&testFieldUser{Name: "a3"}).Error; !isQuotaExceeded(err) {
+				t.Errorf("Create() error = %v, want %v", err, errno.QuotaExceeded)
+			}
+
+			// 删除后释放配额
+			if err := db.Delete(&user).Error; err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if err := db.Create(&testFieldUser{Name: "a3"}).Error; err != nil {
+				t.Errorf("Create() after delete error = %v", err)
+			}
+
+			// 其他租户按自己的配额计数
+			dbB, err := manager.GetDB(WithTenant(context.Background(), "tenant-b"))
+			if err != nil {
+				t.Fatalf("GetDB() error = %v", err)
+			}
+			batchB := []testFieldUser{{Name: "b1"}, {Name: "b2"}, {Name: "b3"}}
+			if err := dbB.Create(&batchB).Error; err != nil {
+				t.Errorf("Create(batch) tenant-b error = %v", err)
+			}
+
+			// 跨租户访问不检查配额
+			dbSystem, err := manager.GetDB(WithSystemScope(context.Background(), "backfill"))
+			if err != nil {
+				t.Fatalf("GetDB() error = %v", err)
+			}
+			if err := dbSystem.Create(&testFieldUser{Name: "a4", TenantID: "tenant-a"}).Error; err != nil {
+				t.Errorf("Create() with system scope error = %v", err)
+			}
+		})
+	}
+}
+
+func TestTenantQuota_RedisCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	quota := NewTenantQuota(&QuotaConfig{
+		Limits: &QuotaLimits{Default: map[string]int64{"test_field_users": 2}},
+		Redis:  client,
+	})
+	manager := newTestFieldDBManager(t, func(config *FieldDBConfig) {
+		config.Quota = quota
+	})
+	db, err := manager.GetDB(WithTenant(context.Background(), "tenant-a"))
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	key := quota.key("tenant-a", "test_field_users")
+	cached := func() string {
+		value, _ := server.Get(key)
+		return value
+	}
+
+	// 缓存不存在时从数据库计数初始化，之后由reserveScript预占
+	user := testFieldUser{Name: "a1"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got := cached(); got != "1" {
+		t.Errorf("cached count after create = %v, want %v", got, "1")
+	}
+
+	// 创建失败时由releaseScript释放预占
+	if err := db.Create(&testFieldUser{ID: user.ID, Name: "duplicate"}).Error; err == nil {
+		t.Fatalf("Create() duplicate error = nil, want error")
+	}
+	if got := cached(); got != "1" {
+		t.Errorf("cached count after failed create = %v, want %v", got, "1")
+	}
+
+	// 更新已有记录的upsert不增加行数
+	for i := 0; i < 2; i++ {
+		upsert := testFieldUser{ID: user.ID, Name: "updated"}
+		if err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&upsert).Error; err != nil {
+			t.Fatalf("Create() upsert error = %v", err)
+		}
+	}
+	if err := db.Create(&testFieldUser{Name: "a2"}).Error; err != nil {
+		t.Fatalf("Create() after upsert error = %v", err)
+	}
+	if got := cached(); got != "2" {
+		t.Errorf("cached count after upsert = %v, want %v", got, "2")
+	}
+	if err := db.Create(&testFieldUser{Name: "a3"}).Error; !isQuotaExceeded(err) {
+		t.Errorf("Create() error = %v, want %v", err, errno.QuotaExceeded)
+	}
+
+	// 删除后释放配额
+	if err := db.Delete(&user).Error; err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got := cached(); got != "1" {
+		t.Errorf("cached count after delete = %v, want %v", got, "1")
+	}
+}
+
+func TestTenantQuota_TenantDBManager(t *testing.T) {
+	config := NewDefaultDBConfig()
+	config.Quota = NewTenantQuota(&QuotaConfig{
+		Limits: &QuotaLimits{Tenants: map[string]map[string]int64{"tenant1": {"test_activities": 1}}},
+	})
+	manager := newTestTenantDBManager(t, config)
+
+	db1, err := manager.GetDB("tenant1")
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	if err := db1.Create(&testActivity{Name: "first"}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := db1.Create(&testActivity{Name: "second"}).Error; !isQuotaExceeded(err) {
+		t.Errorf("Create() error = %v, want %v", err, errno.QuotaExceeded)
+	}
+
+	db2, err := manager.GetDB("tenant2")
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := db2.Create(&testActivity{Name: "unlimited"}).Error; err != nil {
+			t.Errorf("Create() tenant2 error = %v", err)
+		}
+	}
+}
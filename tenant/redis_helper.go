@@ -77,10 +77,15 @@ type RedisHelper interface {
 	ZRem(ctx context.Context, key string, members ...interface{}) error
 
 	// Lock 获取分布式锁
+	// 只尝试一次且不会续期，需要阻塞等待、续期、重入或隔离令牌时使用NewLock
 	Lock(ctx context.Context, key string, value string, expiration time.Duration) (bool, error)
 
 	// Unlock 释放分布式锁
 	Unlock(ctx context.Context, key string, value string) (bool, error)
+
+	// NewLock 创建分布式锁，支持阻塞获取、看门狗续期、重入、隔离令牌和Redlock模式
+	// options为nil时使用NewDefaultLockOptions
+	NewLock(ctx context.Context, key string, options *LockOptions) (*RedisLock, error)
 }
 
 // tenantRedisHelper Redis辅助工具实现
@@ -95,10 +100,21 @@ func NewRedisHelper(manager RedisManager) RedisHelper {
 	}
 }
 
+// resolve 获取上下文中租户的Redis客户端，并为key添加租户前缀
+func (h *tenantRedisHelper) resolve(ctx context.Context, key string) (redis.UniversalClient, string, error) {
+	client, err := h.manager.GetClientFromContext(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, h.manager.WithTenantPrefix(ctx, key), nil
+}
+
 // Set 设置键值对
 func (h *tenantRedisHelper) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return err
+	}
 
 	var strValue string
 	switch v := value.(type) {
@@ -120,8 +136,10 @@ func (h *tenantRedisHelper) Set(ctx context.Context, key string, value interface
 
 // Get 获取值
 func (h *tenantRedisHelper) Get(ctx context.Context, key string) (string, error) {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return "", err
+	}
 
 	result, err := client.Get(ctx, key).Result()
 	if err == redis.Nil {
@@ -146,16 +164,20 @@ func (h *tenantRedisHelper) GetObject(ctx context.Context, key string, dest inte
 
 // Delete 删除键
 func (h *tenantRedisHelper) Delete(ctx context.Context, key string) error {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return err
+	}
 
 	return client.Del(ctx, key).Err()
 }
 
 // Exists 检查键是否存在
 func (h *tenantRedisHelper) Exists(ctx context.Context, key string) (bool, error) {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return false, err
+	}
 
 	result, err := client.Exists(ctx, key).Result()
 	return result > 0, err
@@ -163,24 +185,30 @@ func (h *tenantRedisHelper) Exists(ctx context.Context, key string) (bool, error
 
 // Expire 设置过期时间
 func (h *tenantRedisHelper) Expire(ctx context.Context, key string, expiration time.Duration) error {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return err
+	}
 
 	return client.Expire(ctx, key, expiration).Err()
 }
 
 // Incr 自增
 func (h *tenantRedisHelper) Incr(ctx context.Context, key string) (int64, error) {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return 0, err
+	}
 
 	return client.Incr(ctx, key).Result()
 }
 
 // HSet 设置哈希表字段
 func (h *tenantRedisHelper) HSet(ctx context.Context, key, field string, value interface{}) error {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return err
+	}
 
 	var strValue string
 	switch v := value.(type) {
@@ -202,8 +230,10 @@ func (h *tenantRedisHelper) HSet(ctx context.Context, key, field string, value i
 
 // HGet 获取哈希表字段
 func (h *tenantRedisHelper) HGet(ctx context.Context, key, field string) (string, error) {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return "", err
+	}
 
 	result, err := client.HGet(ctx, key, field).Result()
 	if err == redis.Nil {
@@ -214,112 +244,140 @@ func (h *tenantRedisHelper) HGet(ctx context.Context, key, field string) (string
 
 // HGetAll 获取哈希表所有字段
 func (h *tenantRedisHelper) HGetAll(ctx context.Context, key string) (map[string]string, error) {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
 
 	return client.HGetAll(ctx, key).Result()
 }
 
 // HDel 删除哈希表字段
 func (h *tenantRedisHelper) HDel(ctx context.Context, key string, fields ...string) error {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return err
+	}
 
 	return client.HDel(ctx, key, fields...).Err()
 }
 
 // LPush 将值推入列表左端
 func (h *tenantRedisHelper) LPush(ctx context.Context, key string, values ...interface{}) error {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return err
+	}
 
 	return client.LPush(ctx, key, values...).Err()
 }
 
 // RPush 将值推入列表右端
 func (h *tenantRedisHelper) RPush(ctx context.Context, key string, values ...interface{}) error {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return err
+	}
 
 	return client.RPush(ctx, key, values...).Err()
 }
 
 // LRange 获取列表范围
 func (h *tenantRedisHelper) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
 
 	return client.LRange(ctx, key, start, stop).Result()
 }
 
 // SAdd 添加集合成员
 func (h *tenantRedisHelper) SAdd(ctx context.Context, key string, members ...interface{}) error {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return err
+	}
 
 	return client.SAdd(ctx, key, members...).Err()
 }
 
 // SMembers 获取集合所有成员
 func (h *tenantRedisHelper) SMembers(ctx context.Context, key string) ([]string, error) {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
 
 	return client.SMembers(ctx, key).Result()
 }
 
 // SRem 移除集合成员
 func (h *tenantRedisHelper) SRem(ctx context.Context, key string, members ...interface{}) error {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return err
+	}
 
 	return client.SRem(ctx, key, members...).Err()
 }
 
 // ZAdd 添加有序集合成员
 func (h *tenantRedisHelper) ZAdd(ctx context.Context, key string, members ...redis.Z) error {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return err
+	}
 
 	return client.ZAdd(ctx, key, members...).Err()
 }
 
 // ZRange 获取有序集合范围
 func (h *tenantRedisHelper) ZRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
 
 	return client.ZRange(ctx, key, start, stop).Result()
 }
 
 // ZRangeWithScores 获取有序集合范围及分数
 func (h *tenantRedisHelper) ZRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
 
 	return client.ZRangeWithScores(ctx, key, start, stop).Result()
 }
 
 // ZRem 移除有序集合成员
 func (h *tenantRedisHelper) ZRem(ctx context.Context, key string, members ...interface{}) error {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, key)
+	client, key, err := h.resolve(ctx, key)
+	if err != nil {
+		return err
+	}
 
 	return client.ZRem(ctx, key, members...).Err()
 }
 
 // Lock 获取分布式锁
 func (h *tenantRedisHelper) Lock(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, "lock:"+key)
+	client, key, err := h.resolve(ctx, "lock:"+key)
+	if err != nil {
+		return false, err
+	}
 
 	return client.SetNX(ctx, key, value, expiration).Result()
 }
 
 // Unlock 释放分布式锁
 func (h *tenantRedisHelper) Unlock(ctx context.Context, key string, value string) (bool, error) {
-	client := h.manager.GetClientFromContext(ctx)
-	key = h.manager.WithTenantPrefix(ctx, "lock:"+key)
+	client, key, err := h.resolve(ctx, "lock:"+key)
+	if err != nil {
+		return false, err
+	}
 
 	// 使用Lua脚本确保只删除自己的锁
 	script := `
@@ -0,0 +1,168 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// globEscaper 转义Redis SCAN MATCH模式中的特殊字符
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// scanTenant 使用SCAN分批遍历租户前缀下的key，fn收到key所在节点的客户端
+// 集群模式下各主节点并发遍历，fn的调用是串行的
+func (m *tenantRedisManager) scanTenant(ctx context.Context, tenantID string, fn func(ctx context.Context, node *redis.Client, keys []string) error) error {
+	if tenantID == "" {
+		return fmt.Errorf("tenant ID cannot be empty")
+	}
+	if !m.config.EnableTenantIsolation {
+		return fmt.Errorf("tenant isolation is disabled, keys have no tenant prefix")
+	}
+	if err := m.validateTenant(tenantID); err != nil {
+		return err
+	}
+
+	client, err := m.GetClient(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+
+	match := globEscaper.Replace(m.tenantPrefix(tenantID)) + "*"
+	var mutex sync.Mutex
+	scanNode := func(ctx context.Context, node *redis.Client) error {
+		var cursor uint64
+		for {
+			keys, next, err := node.Scan(ctx, cursor, match, m.config.ScanCount).Result()
+			if err != nil {
+				return fmt.Errorf("failed to scan keys for tenant %s: %w", tenantID, err)
+			}
+
+			if len(keys) > 0 {
+				mutex.Lock()
+				err = fn(ctx, node, keys)
+				mutex.Unlock()
+				if err != nil {
+					return err
+				}
+			}
+
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+
+			// 限速，避免连续SCAN占用Redis
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("scanning keys for tenant %s: %w", tenantID, ctx.Err())
+			case <-time.After(m.config.ScanInterval):
+			}
+		}
+	}
+
+	switch c := client.(type) {
+	case *redis.ClusterClient:
+		return c.ForEachMaster(ctx, scanNode)
+	case *redis.Client:
+		return scanNode(ctx, c)
+	default:
+		return fmt.Errorf("unsupported Redis client type %T", client)
+	}
+}
+
+// ScanTenantKeys 使用SCAN分批遍历租户前缀下的所有key
+func (m *tenantRedisManager) ScanTenantKeys(ctx context.Context, tenantID string, fn func(keys []string) error) error {
+	return m.scanTenant(ctx, tenantID, func(ctx context.Context, node *redis.Client, keys []string) error {
+		return fn(keys)
+	})
+}
+
+// ListTenantKeys 列出租户前缀下的所有key
+func (m *tenantRedisManager) ListTenantKeys(ctx context.Context, tenantID string) ([]string, error) {
+	var result []string
+	err := m.ScanTenantKeys(ctx, tenantID, func(keys []string) error {
+		result = append(result, keys...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CountTenantKeys 统计租户前缀下的key数量
+// SCAN在遍历期间有key增删时可能重复或遗漏，结果为近似值
+func (m *tenantRedisManager) CountTenantKeys(ctx context.Context, tenantID string) (int64, error) {
+	var count int64
+	err := m.ScanTenantKeys(ctx, tenantID, func(keys []string) error {
+		count += int64(len(keys))
+		return nil
+	})
+	return count, err
+}
+
+// TenantMemoryUsage 统计租户前缀下所有key占用的内存字节数
+func (m *tenantRedisManager) TenantMemoryUsage(ctx context.Context, tenantID string) (int64, error) {
+	var total int64
+	err := m.scanTenant(ctx, tenantID, func(ctx context.Context, node *redis.Client, keys []string) error {
+		pipe := node.Pipeline()
+		cmds := make([]*redis.IntCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipe.MemoryUsage(ctx, key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return fmt.Errorf("failed to get memory usage for tenant %s: %w", tenantID, err)
+		}
+
+		for _, cmd := range cmds {
+			// 扫描后已被删除的key返回nil
+			if cmd.Err() == nil {
+				total += cmd.Val()
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// DeleteTenantKeys 使用UNLINK删除租户前缀下的所有key
+// 逐个key执行UNLINK，集群模式下不会出现跨slot错误
+func (m *tenantRedisManager) DeleteTenantKeys(ctx context.Context, tenantID string) (int64, error) {
+	var deleted int64
+	err := m.scanTenant(ctx, tenantID, func(ctx context.Context, node *redis.Client, keys []string) error {
+		pipe := node.Pipeline()
+		cmds := make([]*redis.IntCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipe.Unlink(ctx, key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to delete keys for tenant %s: %w", tenantID, err)
+		}
+
+		for _, cmd := range cmds {
+			deleted += cmd.Val()
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// RedisDeprovisionHook 创建删除租户所有Redis key的钩子，可用于DeprovisionOptions和数据擦除任务
+// 删除完成后移除租户注册的Redis客户端，使用默认客户端的租户不受影响
+func RedisDeprovisionHook(manager RedisManager) TenantHook {
+	return func(ctx context.Context, tenantID string) error {
+		// 严格模式下未注册的租户没有key可删除
+		if _, err := manager.DeleteTenantKeys(ctx, tenantID); err != nil && !errors.Is(err, ErrUnknownRedisTenant) {
+			return err
+		}
+		if err := manager.RemoveTenant(tenantID); err != nil && !errors.Is(err, ErrUnknownRedisTenant) {
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,424 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrLockNotAcquired 上下文结束前没有获取到锁
+	ErrLockNotAcquired = errors.New("lock not acquired")
+	// ErrLockNotHeld 锁没有被当前持有者持有，可能已过期或被其他持有者获取
+	ErrLockNotHeld = errors.New("lock not held")
+	// ErrFencingUnsupported Redlock模式下各实例的计数器互不同步，无法提供单调递增的隔离令牌
+	ErrFencingUnsupported = errors.New("fencing tokens are not supported with Redlock")
+)
+
+const (
+	// lockAcquireLua 获取锁，锁为哈希结构，记录持有者、重入次数和隔离令牌
+	// 返回隔离令牌，未获取到时返回0
+	lockAcquireLua = `
+local owner = redis.call("hget", KEYS[1], "owner")
+if not owner then
+	local fence = redis.call("incr", KEYS[2])
+	redis.call("hset", KEYS[1], "owner", ARGV[1], "count", 1, "fence", fence)
+	redis.call("pexpire", KEYS[1], ARGV[2])
+	return fence
+end
+if owner == ARGV[1] and ARGV[3] == "1" then
+	redis.call("hincrby", KEYS[1], "count", 1)
+	redis.call("pexpire", KEYS[1], ARGV[2])
+	return tonumber(redis.call("hget", KEYS[1], "fence"))
+end
+return 0
+`
+
+	// lockReleaseLua 释放一次锁，重入次数归零时删除锁
+	// 返回剩余重入次数，不是持有者时返回-1
+	lockReleaseLua = `
+if redis.call("hget", KEYS[1], "owner") ~= ARGV[1] then
+	return -1
+end
+local count = redis.call("hincrby", KEYS[1], "count", -1)
+if count <= 0 then
+	redis.call("del", KEYS[1])
+	return 0
+end
+return count
+`
+
+	// lockExtendLua 持有者续期，返回1表示成功
+	lockExtendLua = `
+if redis.call("hget", KEYS[1], "owner") ~= ARGV[1] then
+	return 0
+end
+return redis.call("pexpire", KEYS[1], ARGV[2])
+`
+)
+
+var (
+	lockAcquireScript = redis.NewScript(lockAcquireLua)
+	lockReleaseScript = redis.NewScript(lockReleaseLua)
+	lockExtendScript  = redis.NewScript(lockExtendLua)
+)
+
+// LockOptions 分布式锁选项
+type LockOptions struct {
+	// 锁的过期时间，持有期间由看门狗每TTL/3续期一次
+	// 默认值: 30s
+	TTL time.Duration
+
+	// 获取锁失败后的首次重试间隔，之后每次翻倍并加入随机抖动
+	// 默认值: 50ms
+	RetryBackoff time.Duration
+
+	// 重试间隔上限
+	// 默认值: 1s
+	MaxRetryBackoff time.Duration
+
+	// 是否关闭看门狗，关闭后锁在TTL到期时自动释放，需要自行调用Refresh续期
+	// 默认值: false
+	DisableWatchdog bool
+
+	// 持有者令牌，令牌相同的锁对象视为同一持有者
+	// 默认值: 主机名-进程ID-随机数
+	Owner string
+
+	// 是否可重入，同一持有者可多次获取，释放相同次数后才真正释放
+	// 默认值: false
+	Reentrant bool
+
+	// Redlock模式使用的相互独立的Redis实例，多数实例加锁成功才算获取到锁
+	// 多于一个实例时不提供隔离令牌，需要隔离令牌时使用单个实例
+	// 默认值: nil (使用租户的Redis客户端)
+	RedlockClients []redis.UniversalClient
+}
+
+// NewDefaultLockOptions 创建默认分布式锁选项
+func NewDefaultLockOptions() *LockOptions {
+	return &LockOptions{
+		TTL:             30 * time.Second,
+		RetryBackoff:    50 * time.Millisecond,
+		MaxRetryBackoff: time.Second,
+		Owner:           defaultLockOwner(),
+	}
+}
+
+// RedisLock 基于Redis的分布式锁
+// 同一个锁对象可在多个goroutine中使用，但持有状态属于锁对象，不区分goroutine
+type RedisLock struct {
+	key      string
+	fenceKey string
+	clients  []redis.UniversalClient
+	options  *LockOptions
+
+	mutex sync.Mutex
+	// 当前锁对象的持有次数
+	holds int
+	// 首次获取锁时得到的隔离令牌，只在单个实例时有效
+	token int64
+	// 看门狗续期失败时关闭
+	lost         chan struct{}
+	stopWatchdog context.CancelFunc
+	watchdogDone chan struct{}
+}
+
+// NewLock 创建分布式锁，key自动添加租户前缀
+func (h *tenantRedisHelper) NewLock(ctx context.Context, key string, options *LockOptions) (*RedisLock, error) {
+	client, key, err := h.resolve(ctx, "lock:"+key)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultOptions := NewDefaultLockOptions()
+	if options == nil {
+		options = defaultOptions
+	} else {
+		copied := *options
+		options = &copied
+		if options.TTL <= 0 {
+			options.TTL = defaultOptions.TTL
+		}
+		if options.RetryBackoff <= 0 {
+			options.RetryBackoff = defaultOptions.RetryBackoff
+		}
+		if options.MaxRetryBackoff <= 0 {
+			options.MaxRetryBackoff = defaultOptions.MaxRetryBackoff
+		}
+		if options.Owner == "" {
+			options.Owner = defaultOptions.Owner
+		}
+	}
+
+	clients := options.RedlockClients
+	if len(clients) == 0 {
+		clients = []redis.UniversalClient{client}
+	}
+
+	// 集群模式下锁和隔离计数器必须在同一个slot，才能在一个脚本中访问
+	// 租户前缀{tenant}:已是hash tag，其他模式不加tag，保持租户前缀以便按租户遍历和删除
+	if hasClusterClient(clients) && !hasHashTag(key) {
+		key = "{" + key + "}"
+	}
+	return &RedisLock{
+		key:      key + ":holder",
+		fenceKey: key + ":fence",
+		clients:  clients,
+		options:  options,
+	}, nil
+}
+
+// hasClusterClient 是否有集群模式的客户端
+func hasClusterClient(clients []redis.UniversalClient) bool {
+	for _, client := range clients {
+		if _, ok := client.(*redis.ClusterClient); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHashTag key中是否包含非空的hash tag
+func hasHashTag(key string) bool {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return false
+	}
+	return strings.IndexByte(key[start+1:], '}') > 0
+}
+
+// Acquire 阻塞获取锁，失败后按退避间隔重试，直到获取成功或上下文结束
+// 上下文结束时返回ErrLockNotAcquired
+func (l *RedisLock) Acquire(ctx context.Context) error {
+	backoff := l.options.RetryBackoff
+	for {
+		ok, err := l.TryAcquire(ctx)
+		if ok {
+			return nil
+		}
+
+		// 随机抖动，避免多个等待者同时重试
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("%w: %s: %w", ErrLockNotAcquired, l.key, err)
+			}
+			return fmt.Errorf("%w: %s: %w", ErrLockNotAcquired, l.key, ctx.Err())
+		case <-time.After(wait):
+		}
+
+		if backoff *= 2; backoff > l.options.MaxRetryBackoff {
+			backoff = l.options.MaxRetryBackoff
+		}
+	}
+}
+
+// TryAcquire 尝试获取一次锁，锁被其他持有者持有时返回false
+func (l *RedisLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	reentrant := "0"
+	if l.options.Reentrant {
+		reentrant = "1"
+	}
+
+	start := time.Now()
+	var acquired []redis.UniversalClient
+	var token int64
+	var lastErr error
+	answered := 0
+	for _, client := range l.clients {
+		fence, err := lockAcquireScript.Run(ctx, client, []string{l.key, l.fenceKey},
+			l.options.Owner, l.options.TTL.Milliseconds(), reentrant).Int64()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		answered++
+		if fence > 0 {
+			acquired = append(acquired, client)
+			token = fence
+		}
+	}
+
+	// 按Redlock算法扣除时钟漂移，加锁耗时超过有效期视为失败
+	drift := l.options.TTL/100 + 2*time.Millisecond
+	if len(acquired) >= l.quorum() && time.Since(start) < l.options.TTL-drift {
+		if l.holds == 0 {
+			l.token = token
+			l.startWatchdog(ctx)
+		}
+		l.holds++
+		return true, nil
+	}
+
+	// 未达到多数，撤销已加的锁
+	for _, client := range acquired {
+		_ = lockReleaseScript.Run(ctx, client, []string{l.key}, l.options.Owner).Err()
+	}
+	if answered < l.quorum() && lastErr != nil {
+		return false, fmt.Errorf("failed to acquire lock %s: %w", l.key, lastErr)
+	}
+	return false, nil
+}
+
+// Release 释放一次锁，可重入时释放次数与获取次数相同后才真正释放
+// 锁已过期或被其他持有者获取时返回ErrLockNotHeld
+func (l *RedisLock) Release(ctx context.Context) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.holds == 0 {
+		return fmt.Errorf("%w: %s", ErrLockNotHeld, l.key)
+	}
+	l.holds--
+	if l.holds == 0 {
+		l.stopWatchdog()
+		<-l.watchdogDone
+	}
+
+	released := 0
+	var lastErr error
+	for _, client := range l.clients {
+		count, err := lockReleaseScript.Run(ctx, client, []string{l.key}, l.options.Owner).Int64()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if count >= 0 {
+			released++
+		}
+	}
+
+	if released < l.quorum() {
+		if lastErr != nil {
+			return fmt.Errorf("failed to release lock %s: %w", l.key, lastErr)
+		}
+		return fmt.Errorf("%w: %s", ErrLockNotHeld, l.key)
+	}
+	return nil
+}
+
+// Refresh 将锁的过期时间重置为TTL，关闭看门狗时用于手动续期
+func (l *RedisLock) Refresh(ctx context.Context) error {
+	l.mutex.Lock()
+	held := l.holds > 0
+	l.mutex.Unlock()
+	if !held {
+		return fmt.Errorf("%w: %s", ErrLockNotHeld, l.key)
+	}
+	return l.extend(ctx)
+}
+
+// Token 获取隔离令牌，每次锁被重新获取时递增
+// 下游写入时携带令牌，拒绝令牌小于已见过最大值的请求，防止锁过期后旧持有者的写入
+// 令牌来自单个实例上的计数器，Redlock模式下加锁失败或部分成功会使各实例的计数器分叉，
+// 取最大值也不能保证后来的持有者得到更大的令牌，因此返回ErrFencingUnsupported
+func (l *RedisLock) Token() (int64, error) {
+	if len(l.clients) > 1 {
+		return 0, fmt.Errorf("%w: %s", ErrFencingUnsupported, l.key)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.token, nil
+}
+
+// Lost 看门狗续期失败、锁已丢失时关闭的通道，持有锁的任务应监听它并中止
+// 未持有锁时返回已关闭的通道
+func (l *RedisLock) Lost() <-chan struct{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.holds == 0 {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	return l.lost
+}
+
+// quorum 获取锁需要成功的实例数
+func (l *RedisLock) quorum() int {
+	return len(l.clients)/2 + 1
+}
+
+// extend 在多数实例上续期
+func (l *RedisLock) extend(ctx context.Context) error {
+	extended := 0
+	var lastErr error
+	for _, client := range l.clients {
+		ok, err := lockExtendScript.Run(ctx, client, []string{l.key}, l.options.Owner, l.options.TTL.Milliseconds()).Int64()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if ok == 1 {
+			extended++
+		}
+	}
+
+	if extended >= l.quorum() {
+		return nil
+	}
+	if lastErr != nil {
+		return fmt.Errorf("failed to extend lock %s: %w", l.key, lastErr)
+	}
+	return fmt.Errorf("%w: %s", ErrLockNotHeld, l.key)
+}
+
+// startWatchdog 首次获取锁时启动看门狗，调用方需持有l.mutex
+func (l *RedisLock) startWatchdog(ctx context.Context) {
+	// 看门狗的生命周期跟随锁而不是获取锁时的上下文
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	l.lost = make(chan struct{})
+	l.stopWatchdog = cancel
+	l.watchdogDone = make(chan struct{})
+	if l.options.DisableWatchdog {
+		close(l.watchdogDone)
+		return
+	}
+	go l.watchdog(ctx, l.lost, l.watchdogDone)
+}
+
+// watchdog 定期续期，锁被其他持有者获取或续期失败超过TTL时关闭lost
+func (l *RedisLock) watchdog(ctx context.Context, lost, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(l.options.TTL / 3)
+	defer ticker.Stop()
+
+	expiresAt := time.Now().Add(l.options.TTL)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		attempt := time.Now()
+		err := l.extend(ctx)
+		if err == nil {
+			expiresAt = attempt.Add(l.options.TTL)
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, ErrLockNotHeld) || time.Now().After(expiresAt) {
+			klog.CtxWarnf(ctx, "lost Redis lock: %v", err)
+			close(lost)
+			return
+		}
+		klog.CtxWarnf(ctx, "Redis lock watchdog will retry: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/onebids/onecommon/tools"
+	"github.com/redis/go-redis/v9"
+)
+
+// testLockKey tenant1的job锁在Redis中的key
+const testLockKey = "tenant1:lock:job:holder"
+
+// newTestLockManager 创建默认客户端连接到miniredis的Redis管理器，锁的Lua脚本由miniredis执行
+func newTestLockManager(t *testing.T) (RedisManager, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	manager, _ := newTestRedisManager(t, false, func(config *RedisConfig) {
+		config.DefaultOptions = testRedisOptions(RedisStandalone, server.Addr())
+	})
+	return manager, server
+}
+
+// newTestLock 创建tenant1的分布式锁
+func newTestLock(t *testing.T, helper RedisHelper, options *LockOptions) *RedisLock {
+	t.Helper()
+	lock, err := helper.NewLock(tools.WithTenant(context.Background(), "tenant1"), "job", options)
+	if err != nil {
+		t.Fatalf("NewLock() error = %v", err)
+	}
+	return lock
+}
+
+func TestRedisLock_AcquireRelease(t *testing.T) {
+	manager, server := newTestLockManager(t)
+	helper := NewRedisHelper(manager)
+	ctx := context.Background()
+	options := &LockOptions{TTL: 300 * time.Millisecond, RetryBackoff: 10 * time.Millisecond}
+
+	first := newTestLock(t, helper, options)
+	if err := first.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if got, err := first.Token(); got != 1 || err != nil {
+		t.Errorf("Token() = %v, %v, want %v", got, err, 1)
+	}
+	if owner := server.HGet(testLockKey, "owner"); owner != first.options.Owner {
+		t.Errorf("lock owner = %v, want %v", owner, first.options.Owner)
+	}
+
+	second := newTestLock(t, helper, options)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := second.Acquire(timeoutCtx); !errors.Is(err, ErrLockNotAcquired) {
+		t.Errorf("Acquire() held by other error = %v, want %v", err, ErrLockNotAcquired)
+	}
+
+	// miniredis的时间只随FastForward前进，看门狗续期后剩余时间恢复为TTL
+	server.FastForward(options.TTL * 2 / 3)
+	time.Sleep(options.TTL / 2)
+	if ttl := server.TTL(testLockKey); ttl <= options.TTL/2 {
+		t.Errorf("lock TTL after watchdog = %v, want about %v", ttl, options.TTL)
+	}
+	server.FastForward(options.TTL * 2 / 3)
+	if ok, err := second.TryAcquire(ctx); ok || err != nil {
+		t.Errorf("TryAcquire() after TTL = %v, %v, want false", ok, err)
+	}
+	select {
+	case <-first.Lost():
+		t.Errorf("Lost() closed while watchdog is running")
+	default:
+	}
+
+	if err := first.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if err := first.Release(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Release() again error = %v, want %v", err, ErrLockNotHeld)
+	}
+	if err := second.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() after release error = %v", err)
+	}
+	if got, err := second.Token(); got != 2 || err != nil {
+		t.Errorf("Token() = %v, %v, want %v", got, err, 2)
+	}
+	if err := second.Release(ctx); err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+}
+
+func TestRedisLock_Keys(t *testing.T) {
+	manager, server := newTestLockManager(t)
+	helper := NewRedisHelper(manager)
+	ctx := context.Background()
+
+	// 单机模式下锁的key保持租户前缀，注销租户时随租户的key一起删除
+	lock := newTestLock(t, helper, nil)
+	if err := lock.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if keys, err := manager.ListTenantKeys(ctx, "tenant1"); err != nil || len(keys) != 1 || keys[0] != "tenant1:lock:job:fence" {
+		t.Errorf("ListTenantKeys() = %v, %v, want [tenant1:lock:job:fence]", keys, err)
+	}
+	if err := RedisDeprovisionHook(manager)(ctx, "tenant1"); err != nil {
+		t.Fatalf("RedisDeprovisionHook() error = %v", err)
+	}
+	if server.Exists("tenant1:lock:job:fence") {
+		t.Errorf("fence counter exists after deprovision")
+	}
+
+	// 集群模式下租户前缀已是hash tag，锁和隔离计数器落在同一个slot
+	cluster := miniredis.RunT(t)
+	if err := manager.AddTenant(ctx, "tenant2", testRedisOptions(RedisCluster, cluster.Addr())); err != nil {
+		t.Fatalf("AddTenant() error = %v", err)
+	}
+	clusterLock, err := helper.NewLock(tools.WithTenant(ctx, "tenant2"), "job", nil)
+	if err != nil {
+		t.Fatalf("NewLock() error = %v", err)
+	}
+	if err := clusterLock.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() cluster error = %v", err)
+	}
+	if !cluster.Exists("{tenant2}:lock:job:holder") || !cluster.Exists("{tenant2}:lock:job:fence") {
+		t.Errorf("cluster keys = %v, want {tenant2}:lock:job:holder and fence", cluster.Keys())
+	}
+	if err := clusterLock.Release(ctx); err != nil {
+		t.Errorf("Release() cluster error = %v", err)
+	}
+}
+
+func TestRedisLock_Reentrant(t *testing.T) {
+	manager, _ := newTestLockManager(t)
+	helper := NewRedisHelper(manager)
+	ctx := context.Background()
+
+	options := &LockOptions{Owner: "worker-1", Reentrant: true}
+	outer := newTestLock(t, helper, options)
+	inner := newTestLock(t, helper, options)
+	other := newTestLock(t, helper, nil)
+
+	if err := outer.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if err := inner.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() reentrant error = %v", err)
+	}
+	innerToken, _ := inner.Token()
+	outerToken, _ := outer.Token()
+	if innerToken != outerToken {
+		t.Errorf("Token() reentrant = %v, want %v", innerToken, outerToken)
+	}
+
+	if err := inner.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if ok, _ := other.TryAcquire(ctx); ok {
+		t.Errorf("TryAcquire() while outer holds = true, want false")
+	}
+	if err := outer.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if ok, err := other.TryAcquire(ctx); !ok || err != nil {
+		t.Errorf("TryAcquire() after release = %v, %v, want true", ok, err)
+	}
+
+	// 不可重入时同一持有者不能再次获取
+	single := newTestLock(t, helper, &LockOptions{Owner: "worker-2"})
+	if err := other.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if ok, _ := single.TryAcquire(ctx); !ok {
+		t.Fatalf("TryAcquire() = false, want true")
+	}
+	if ok, _ := single.TryAcquire(ctx); ok {
+		t.Errorf("TryAcquire() non-reentrant again = true, want false")
+	}
+}
+
+func TestRedisLock_Lost(t *testing.T) {
+	manager, server := newTestLockManager(t)
+	helper := NewRedisHelper(manager)
+	ctx := context.Background()
+
+	lock := newTestLock(t, helper, &LockOptions{TTL: 150 * time.Millisecond})
+	if err := lock.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	// 锁被其他持有者获取后看门狗续期失败
+	server.HSet(testLockKey, "owner", "intruder")
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatalf("Lost() not closed after lock was taken over")
+	}
+	if err := lock.Refresh(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Refresh() error = %v, want %v", err, ErrLockNotHeld)
+	}
+	if err := lock.Release(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Release() error = %v, want %v", err, ErrLockNotHeld)
+	}
+
+	// 关闭看门狗时锁在TTL后过期
+	server.Del(testLockKey)
+	expiring := newTestLock(t, helper, &LockOptions{TTL: 100 * time.Millisecond, DisableWatchdog: true})
+	if err := expiring.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	server.FastForward(200 * time.Millisecond)
+	if ok, err := newTestLock(t, helper, nil).TryAcquire(ctx); !ok || err != nil {
+		t.Errorf("TryAcquire() after expiry = %v, %v, want true", ok, err)
+	}
+}
+
+func TestRedisLock_Redlock(t *testing.T) {
+	manager, _ := newTestLockManager(t)
+	helper := NewRedisHelper(manager)
+	ctx := context.Background()
+
+	var clients []redis.UniversalClient
+	for _, addr := range []string{miniredis.RunT(t).Addr(), miniredis.RunT(t).Addr(), "127.0.0.1:1"} {
+		client := redis.NewClient(&redis.Options{Addr: addr, DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+		t.Cleanup(func() { _ = client.Close() })
+		clients = append(clients, client)
+	}
+
+	// 三个实例中一个不可用，仍能在多数实例上获取锁
+	first := newTestLock(t, helper, &LockOptions{RedlockClients: clients})
+	if ok, err := first.TryAcquire(ctx); !ok || err != nil {
+		t.Fatalf("TryAcquire() = %v, %v, want true", ok, err)
+	}
+	second := newTestLock(t, helper, &LockOptions{RedlockClients: clients})
+	if ok, err := second.TryAcquire(ctx); ok || err != nil {
+		t.Errorf("TryAcquire() held by other = %v, %v, want false", ok, err)
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if ok, err := second.TryAcquire(ctx); !ok || err != nil {
+		t.Errorf("TryAcquire() after release = %v, %v, want true", ok, err)
+	}
+	// 各实例的计数器互不同步，Redlock模式不提供隔离令牌
+	if _, err := second.Token(); !errors.Is(err, ErrFencingUnsupported) {
+		t.Errorf("Token() error = %v, want %v", err, ErrFencingUnsupported)
+	}
+
+	// 多数实例不可用时返回错误
+	unavailable := newTestLock(t, helper, &LockOptions{RedlockClients: clients[2:]})
+	if ok, err := unavailable.TryAcquire(ctx); ok || err == nil {
+		t.Errorf("TryAcquire() unavailable = %v, %v, want error", ok, err)
+	}
+}
@@ -3,10 +3,13 @@ package tenant
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
 
-	"github.com/onebids/onecommon/consts"
+	"github.com/onebids/onecommon/tools"
+	"strings"
 	"sync"
 	"time"
 )
@@ -14,26 +17,93 @@ import (
 // RedisConfig Redis管理器配置
 type RedisConfig struct {
 	// 默认Redis配置，当租户没有特定配置时使用
-	DefaultOptions *redis.Options
+	DefaultOptions *RedisOptions
 	// 租户特定的Redis配置，key为租户ID，value为Redis连接选项
-	TenantOptions map[string]*redis.Options
+	TenantOptions map[string]*RedisOptions
 	// 是否启用租户隔离，如果启用，则会使用租户ID作为key前缀
+	// 集群模式下前缀使用hash tag，如{tenant1}:key，保证同一租户的多key操作落在同一个slot
 	EnableTenantIsolation bool
-	// 租户隔离时的分隔符
+	// 租户隔离时的分隔符，租户ID不能包含分隔符，否则一个租户的前缀会匹配另一个租户的key
 	TenantSeparator string
+	// 严格模式，未注册的租户获取客户端时返回ErrUnknownRedisTenant，而不是使用默认客户端
+	// 默认值: false
+	StrictMode bool
+	// 按租户遍历key时每批SCAN的COUNT参数
+	// 默认值: 100
+	ScanCount int64
+	// 按租户遍历key时两批SCAN之间的间隔，用于限速，避免长时间占用Redis
+	// 默认值: 10ms
+	ScanInterval time.Duration
+	// 是否为所有客户端安装钩子，记录OpenTelemetry追踪和命令耗时指标
+	// 默认值: false
+	EnableInstrumentation bool
+	// 指标中单独统计的租户数量上限，超出的租户合并到_other标签，防止标签基数过大
+	// 默认值: 100
+	MaxMetricTenants int
+}
+
+var (
+	// ErrUnknownRedisTenant 租户没有注册Redis客户端
+	ErrUnknownRedisTenant = errors.New("no Redis client registered for tenant")
+	// ErrInvalidRedisTenant 启用租户隔离时租户ID包含分隔符
+	ErrInvalidRedisTenant = errors.New("tenant ID contains the Redis key separator")
+)
+
+// RedisMode Redis部署模式
+type RedisMode string
+
+const (
+	// RedisStandalone 单机模式，连接Addrs中的第一个地址
+	RedisStandalone RedisMode = "standalone"
+	// RedisSentinel 哨兵模式，Addrs为哨兵地址，需要设置MasterName
+	RedisSentinel RedisMode = "sentinel"
+	// RedisCluster 集群模式，Addrs为集群种子节点地址
+	RedisCluster RedisMode = "cluster"
+)
+
+// RedisOptions Redis连接选项
+type RedisOptions struct {
+	// 部署模式
+	// 默认值: RedisStandalone
+	Mode RedisMode
+	// 连接选项，按部署模式转换为对应客户端的选项
+	redis.UniversalOptions
+}
+
+// newClient 根据部署模式创建Redis客户端
+func (o *RedisOptions) newClient() (redis.UniversalClient, error) {
+	switch o.Mode {
+	case "", RedisStandalone:
+		return redis.NewClient(o.Simple()), nil
+	case RedisSentinel:
+		if o.MasterName == "" {
+			return nil, fmt.Errorf("sentinel mode requires MasterName")
+		}
+		return redis.NewFailoverClient(o.Failover()), nil
+	case RedisCluster:
+		return redis.NewClusterClient(o.Cluster()), nil
+	default:
+		return nil, fmt.Errorf("unsupported Redis mode: %s", o.Mode)
+	}
 }
 
 // NewDefaultRedisConfig 创建默认Redis配置
 func NewDefaultRedisConfig() *RedisConfig {
 	return &RedisConfig{
-		DefaultOptions: &redis.Options{
-			Addr:     "localhost:6379",
-			Password: "",
-			DB:       0,
+		DefaultOptions: &RedisOptions{
+			Mode: RedisStandalone,
+			UniversalOptions: redis.UniversalOptions{
+				Addrs:    []string{"localhost:6379"},
+				Password: "",
+				DB:       0,
+			},
 		},
-		TenantOptions:         make(map[string]*redis.Options),
+		TenantOptions:         make(map[string]*RedisOptions),
 		EnableTenantIsolation: true,
 		TenantSeparator:       ":",
+		ScanCount:             100,
+		ScanInterval:          10 * time.Millisecond,
+		MaxMetricTenants:      100,
 	}
 }
 
@@ -41,24 +111,59 @@ func NewDefaultRedisConfig() *RedisConfig {
 type RedisManager interface {
 	// GetClient 获取Redis客户端
 	// 如果tenantID为空，则返回默认客户端
-	GetClient(ctx context.Context, tenantID string) *redis.Client
+	// 租户未注册时返回默认客户端，严格模式下返回ErrUnknownRedisTenant
+	GetClient(ctx context.Context, tenantID string) (redis.UniversalClient, error)
 
 	// GetClientFromContext 从上下文中获取租户ID，然后获取对应的Redis客户端
-	GetClientFromContext(ctx context.Context) *redis.Client
+	GetClientFromContext(ctx context.Context) (redis.UniversalClient, error)
+
+	// AddTenant 注册租户并创建Redis客户端，租户已注册时返回错误
+	AddTenant(ctx context.Context, tenantID string, options *RedisOptions) error
+
+	// UpdateTenant 使用新的连接选项替换租户的Redis客户端，并关闭旧客户端
+	// 切换到或切换出集群模式会改变租户的key前缀，已有数据需要自行迁移
+	UpdateTenant(ctx context.Context, tenantID string, options *RedisOptions) error
+
+	// RemoveTenant 移除租户并关闭其Redis客户端
+	RemoveTenant(tenantID string) error
 
 	// Close 关闭所有Redis连接
 	Close() error
 
 	// WithTenantPrefix 在key前面添加租户前缀
 	WithTenantPrefix(ctx context.Context, key string) string
+
+	// ScanTenantKeys 使用SCAN分批遍历租户前缀下的所有key，集群模式下遍历每个主节点
+	// 批次之间按ScanInterval限速，fn返回错误时停止遍历，需要启用租户隔离
+	ScanTenantKeys(ctx context.Context, tenantID string, fn func(keys []string) error) error
+
+	// ListTenantKeys 列出租户前缀下的所有key
+	ListTenantKeys(ctx context.Context, tenantID string) ([]string, error)
+
+	// CountTenantKeys 统计租户前缀下的key数量
+	CountTenantKeys(ctx context.Context, tenantID string) (int64, error)
+
+	// TenantMemoryUsage 统计租户前缀下所有key占用的内存字节数
+	TenantMemoryUsage(ctx context.Context, tenantID string) (int64, error)
+
+	// DeleteTenantKeys 使用UNLINK删除租户前缀下的所有key，返回删除的数量
+	DeleteTenantKeys(ctx context.Context, tenantID string) (int64, error)
+
+	// RegisterMetrics 将连接池统计和命令耗时注册为Prometheus指标
+	// registerer为nil时使用mtl.Registry
+	RegisterMetrics(registerer prometheus.Registerer) error
 }
 
 // tenantRedisManager Redis管理器实现
 type tenantRedisManager struct {
-	clients       map[string]*redis.Client
+	clients       map[string]redis.UniversalClient
 	mutex         sync.RWMutex
 	config        *RedisConfig
-	defaultClient *redis.Client
+	defaultClient redis.UniversalClient
+	// 命令耗时指标，未启用EnableInstrumentation时为nil
+	metrics *redisMetrics
+	// 命令耗时和连接池统计共用的租户标签
+	labels *tenantLabels
 }
 
 // NewRedisManager 创建Redis管理器
@@ -71,33 +176,55 @@ func NewRedisManager(config *RedisConfig) (RedisManager, error) {
 		return nil, fmt.Errorf("default Redis options cannot be nil")
 	}
 
+	defaultConfig := NewDefaultRedisConfig()
+	if config.ScanCount <= 0 {
+		config.ScanCount = defaultConfig.ScanCount
+	}
+	if config.ScanInterval <= 0 {
+		config.ScanInterval = defaultConfig.ScanInterval
+	}
+	if config.MaxMetricTenants <= 0 {
+		config.MaxMetricTenants = defaultConfig.MaxMetricTenants
+	}
+
 	manager := &tenantRedisManager{
-		clients: make(map[string]*redis.Client),
+		clients: make(map[string]redis.UniversalClient),
 		config:  config,
+		labels:  newTenantLabels(config.MaxMetricTenants),
+	}
+	if config.EnableInstrumentation {
+		manager.metrics = newRedisMetrics(manager.labels)
 	}
 
 	// 创建默认客户端
-	defaultClient := redis.NewClient(config.DefaultOptions)
+	defaultClient, err := config.DefaultOptions.newClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create default Redis client: %w", err)
+	}
+	manager.instrument(defaultClient, "")
 
 	// 测试默认连接
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := defaultClient.Ping(ctx).Err(); err != nil {
+		_ = defaultClient.Close()
 		return nil, fmt.Errorf("failed to connect to default Redis: %w", err)
 	}
 
 	manager.defaultClient = defaultClient
 
+	if config.TenantOptions == nil {
+		config.TenantOptions = make(map[string]*RedisOptions)
+	}
+
 	// 初始化租户客户端
 	for tenantID, options := range config.TenantOptions {
-		client := redis.NewClient(options)
-
-		// 测试连接
-		if err := client.Ping(ctx).Err(); err != nil {
+		client, err := manager.newRedisClient(ctx, tenantID, options)
+		if err != nil {
 			// 关闭已创建的连接
 			_ = manager.Close()
-			return nil, fmt.Errorf("failed to connect to Redis for tenant %s: %w", tenantID, err)
+			return nil, err
 		}
 
 		manager.clients[tenantID] = client
@@ -106,10 +233,38 @@ func NewRedisManager(config *RedisConfig) (RedisManager, error) {
 	return manager, nil
 }
 
+// newRedisClient 创建租户的Redis客户端并测试连接
+func (m *tenantRedisManager) newRedisClient(ctx context.Context, tenantID string, options *RedisOptions) (redis.UniversalClient, error) {
+	if err := m.validateTenant(tenantID); err != nil {
+		return nil, err
+	}
+	if options == nil {
+		return nil, fmt.Errorf("tenant %s Redis options cannot be nil", tenantID)
+	}
+
+	client, err := options.newClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Redis client for tenant %s: %w", tenantID, err)
+	}
+	m.instrument(client, tenantID)
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis for tenant %s: %w", tenantID, err)
+	}
+	return client, nil
+}
+
+// instrument 启用EnableInstrumentation时为客户端安装追踪和指标钩子
+func (m *tenantRedisManager) instrument(client redis.UniversalClient, tenantID string) {
+	if m.config.EnableInstrumentation {
+		client.AddHook(newRedisHook(tenantID, m.metrics))
+	}
+}
+
 // GetClient 获取Redis客户端
-func (m *tenantRedisManager) GetClient(ctx context.Context, tenantID string) *redis.Client {
+func (m *tenantRedisManager) GetClient(ctx context.Context, tenantID string) (redis.UniversalClient, error) {
 	if tenantID == "" {
-		return m.defaultClient
+		return m.defaultClient, nil
 	}
 
 	m.mutex.RLock()
@@ -117,19 +272,105 @@ func (m *tenantRedisManager) GetClient(ctx context.Context, tenantID string) *re
 	m.mutex.RUnlock()
 
 	if exists {
-		return client
+		return client, nil
+	}
+
+	if m.config.StrictMode {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRedisTenant, tenantID)
 	}
 
 	// 如果没有找到特定租户的客户端，使用默认客户端
-	return m.defaultClient
+	return m.defaultClient, nil
 }
 
 // GetClientFromContext 从上下文中获取租户ID，然后获取对应的Redis客户端
-func (m *tenantRedisManager) GetClientFromContext(ctx context.Context) *redis.Client {
+func (m *tenantRedisManager) GetClientFromContext(ctx context.Context) (redis.UniversalClient, error) {
 	tenantID := getTenantIDFromContext(ctx)
 	return m.GetClient(ctx, tenantID)
 }
 
+// AddTenant 注册租户并创建Redis客户端
+func (m *tenantRedisManager) AddTenant(ctx context.Context, tenantID string, options *RedisOptions) error {
+	if tenantID == "" {
+		return fmt.Errorf("tenant ID cannot be empty")
+	}
+
+	m.mutex.RLock()
+	_, exists := m.clients[tenantID]
+	m.mutex.RUnlock()
+	if exists {
+		return fmt.Errorf("tenant %s already has a Redis client", tenantID)
+	}
+
+	// 在锁外测试连接，避免阻塞其他租户
+	client, err := m.newRedisClient(ctx, tenantID, options)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	if _, exists := m.clients[tenantID]; exists {
+		m.mutex.Unlock()
+		_ = client.Close()
+		return fmt.Errorf("tenant %s already has a Redis client", tenantID)
+	}
+	m.clients[tenantID] = client
+	m.config.TenantOptions[tenantID] = options
+	m.mutex.Unlock()
+
+	return nil
+}
+
+// UpdateTenant 使用新的连接选项替换租户的Redis客户端
+// 新客户端连接成功后才替换，旧客户端上尚未完成的命令会因关闭而失败
+func (m *tenantRedisManager) UpdateTenant(ctx context.Context, tenantID string, options *RedisOptions) error {
+	m.mutex.RLock()
+	_, exists := m.clients[tenantID]
+	m.mutex.RUnlock()
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownRedisTenant, tenantID)
+	}
+
+	client, err := m.newRedisClient(ctx, tenantID, options)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	old, exists := m.clients[tenantID]
+	if !exists {
+		// 替换期间租户已被移除
+		m.mutex.Unlock()
+		_ = client.Close()
+		return fmt.Errorf("%w: %s", ErrUnknownRedisTenant, tenantID)
+	}
+	m.clients[tenantID] = client
+	m.config.TenantOptions[tenantID] = options
+	m.mutex.Unlock()
+
+	if err := old.Close(); err != nil {
+		return fmt.Errorf("failed to close Redis client for tenant %s: %w", tenantID, err)
+	}
+	return nil
+}
+
+// RemoveTenant 移除租户并关闭其Redis客户端
+func (m *tenantRedisManager) RemoveTenant(tenantID string) error {
+	m.mutex.Lock()
+	client, exists := m.clients[tenantID]
+	delete(m.clients, tenantID)
+	delete(m.config.TenantOptions, tenantID)
+	m.mutex.Unlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownRedisTenant, tenantID)
+	}
+	if err := client.Close(); err != nil {
+		return fmt.Errorf("failed to close Redis client for tenant %s: %w", tenantID, err)
+	}
+	return nil
+}
+
 // Close 关闭所有Redis连接
 func (m *tenantRedisManager) Close() error {
 	m.mutex.Lock()
@@ -166,19 +407,43 @@ func (m *tenantRedisManager) WithTenantPrefix(ctx context.Context, key string) s
 		return key
 	}
 
-	return fmt.Sprintf("%s%s%s", tenantID, m.config.TenantSeparator, key)
+	return m.tenantPrefix(tenantID) + key
 }
 
-// getTenantIDFromContext 从上下文中获取租户ID
-func getTenantIDFromContext(ctx context.Context) string {
-	if ctx == nil {
-		return ""
+// validateTenant 检查租户ID是否可以用作key前缀
+// 租户ID包含分隔符时，如a:b的key也以a:开头，按租户遍历和删除a的key时会误删a:b的key
+func (m *tenantRedisManager) validateTenant(tenantID string) error {
+	separator := m.config.TenantSeparator
+	if m.config.EnableTenantIsolation && separator != "" && strings.Contains(tenantID, separator) {
+		return fmt.Errorf("%w: %s", ErrInvalidRedisTenant, tenantID)
 	}
+	return nil
+}
 
-	tenantID, ok := ctx.Value(consts.TenantID).(string)
-	if !ok || tenantID == "" {
-		return ""
+// tenantPrefix 租户的key前缀
+func (m *tenantRedisManager) tenantPrefix(tenantID string) string {
+	if m.isCluster(tenantID) {
+		// hash tag使同一租户的key映射到同一个slot，多key命令和Lua脚本不会跨slot
+		return fmt.Sprintf("{%s}%s", tenantID, m.config.TenantSeparator)
 	}
+	return tenantID + m.config.TenantSeparator
+}
 
+// isCluster 租户使用的Redis客户端是否为集群模式
+func (m *tenantRedisManager) isCluster(tenantID string) bool {
+	m.mutex.RLock()
+	client, exists := m.clients[tenantID]
+	m.mutex.RUnlock()
+	if !exists {
+		client = m.defaultClient
+	}
+
+	_, ok := client.(*redis.ClusterClient)
+	return ok
+}
+
+// getTenantIDFromContext 从上下文中获取租户ID
+func getTenantIDFromContext(ctx context.Context) string {
+	tenantID, _ := tools.ResolveTenant(ctx)
 	return tenantID
 }
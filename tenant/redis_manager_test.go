@@ -0,0 +1,571 @@
+package tenant
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/onebids/onecommon/consts"
+	"github.com/onebids/onecommon/tools"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeRedis 测试用的最小Redis服务端，使用RESP2协议，只实现测试需要的命令
+type fakeRedis struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	data     map[string]string
+	// 按写入顺序记录出现过的key，SCAN游标为其中的位置，删除key不影响游标
+	keys []string
+}
+
+// newFakeRedis 启动测试用的Redis服务端，测试结束时关闭
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	server := &fakeRedis{
+		listener: listener,
+		data:     make(map[string]string),
+	}
+	go server.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+	return server
+}
+
+// Addr 服务端地址
+func (s *fakeRedis) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// serve 接受连接
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle 逐条读取命令并回复
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readFakeCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, s.execute(args)); err != nil {
+			return
+		}
+	}
+}
+
+// readFakeCommand 读取一条RESP数组格式的命令
+func readFakeCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// execute 执行命令并返回RESP格式的回复
+func (s *fakeRedis) execute(args []string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "HELLO":
+		// 不支持RESP3，客户端回退到RESP2
+		return "-ERR unknown command 'HELLO'\r\n"
+	case "CLIENT", "SELECT":
+		return "+OK\r\n"
+	case "CLUSTER":
+		// 单节点集群，负责全部slot
+		host, port, _ := net.SplitHostPort(s.Addr())
+		return fmt.Sprintf("*1\r\n*3\r\n:0\r\n:16383\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n", len(host), host, port)
+	case "SET":
+		if _, ok := s.data[args[1]]; !ok {
+			s.keys = append(s.keys, args[1])
+		}
+		s.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case "GET":
+		value, ok := s.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SCAN":
+		return s.scan(args[1:])
+	case "MEMORY":
+		value, ok := s.data[args[2]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", len(args[2])+len(value))
+	case "DEL", "UNLINK":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.data[key]; ok {
+				delete(s.data, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+}
+
+// scan 按写入顺序分批返回匹配的key，游标为下一批的起始位置
+func (s *fakeRedis) scan(args []string) string {
+	cursor, _ := strconv.Atoi(args[0])
+	match, count := "*", 10
+	for i := 1; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			match = args[i+1]
+		case "COUNT":
+			count, _ = strconv.Atoi(args[i+1])
+		}
+	}
+
+	next := cursor + count
+	if next >= len(s.keys) {
+		next = 0
+	}
+	end := cursor + count
+	if end > len(s.keys) {
+		end = len(s.keys)
+	}
+
+	var matched []string
+	for _, key := range s.keys[cursor:end] {
+		if _, ok := s.data[key]; !ok {
+			continue
+		}
+		if ok, _ := path.Match(match, key); ok {
+			matched = append(matched, key)
+		}
+	}
+
+	reply := fmt.Sprintf("*2\r\n$%d\r\n%d\r\n*%d\r\n", len(strconv.Itoa(next)), next, len(matched))
+	for _, key := range matched {
+		reply += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+	}
+	return reply
+}
+
+// newTestRedisManager 创建连接到测试服务端的Redis管理器
+func newTestRedisManager(t *testing.T, strict bool, options ...func(*RedisConfig)) (RedisManager, *fakeRedis) {
+	t.Helper()
+	server := newFakeRedis(t)
+	config := NewDefaultRedisConfig()
+	config.DefaultOptions = testRedisOptions(RedisStandalone, server.Addr())
+	config.StrictMode = strict
+	for _, option := range options {
+		option(config)
+	}
+
+	manager, err := NewRedisManager(config)
+	if err != nil {
+		t.Fatalf("NewRedisManager() error = %v", err)
+	}
+	t.Cleanup(func() { _ = manager.Close() })
+	return manager, server
+}
+
+// testRedisOptions 创建连接到测试服务端的Redis连接选项
+func testRedisOptions(mode RedisMode, addr string) *RedisOptions {
+	return &RedisOptions{Mode: mode, UniversalOptions: redis.UniversalOptions{Addrs: []string{addr}}}
+}
+
+// clientAddr 获取租户单机客户端连接的地址
+func clientAddr(t *testing.T, manager RedisManager, tenantID string) string {
+	t.Helper()
+	client, err := manager.GetClient(context.Background(), tenantID)
+	if err != nil {
+		t.Fatalf("GetClient() error = %v", err)
+	}
+	standalone, ok := client.(*redis.Client)
+	if !ok {
+		t.Fatalf("GetClient() = %T, want *redis.Client", client)
+	}
+	return standalone.Options().Addr
+}
+
+func TestRedisManager_DynamicTenants(t *testing.T) {
+	manager, defaultServer := newTestRedisManager(t, false)
+	ctx := context.Background()
+
+	if got := clientAddr(t, manager, "tenant1"); got != defaultServer.Addr() {
+		t.Errorf("GetClient() unknown tenant addr = %v, want default %v", got, defaultServer.Addr())
+	}
+
+	first := newFakeRedis(t)
+	if err := manager.AddTenant(ctx, "tenant1", testRedisOptions(RedisStandalone, first.Addr())); err != nil {
+		t.Fatalf("AddTenant() error = %v", err)
+	}
+	if got := clientAddr(t, manager, "tenant1"); got != first.Addr() {
+		t.Errorf("GetClient() addr = %v, want %v", got, first.Addr())
+	}
+	if err := manager.AddTenant(ctx, "tenant1", testRedisOptions(RedisStandalone, first.Addr())); err == nil {
+		t.Errorf("AddTenant() duplicate error = nil, want error")
+	}
+
+	old, err := manager.GetClient(ctx, "tenant1")
+	if err != nil {
+		t.Fatalf("GetClient() error = %v", err)
+	}
+	second := newFakeRedis(t)
+	if err := manager.UpdateTenant(ctx, "tenant1", testRedisOptions(RedisStandalone, second.Addr())); err != nil {
+		t.Fatalf("UpdateTenant() error = %v", err)
+	}
+	if got := clientAddr(t, manager, "tenant1"); got != second.Addr() {
+		t.Errorf("GetClient() after update addr = %v, want %v", got, second.Addr())
+	}
+	if err := old.Ping(ctx).Err(); !errors.Is(err, redis.ErrClosed) {
+		t.Errorf("old client Ping() error = %v, want %v", err, redis.ErrClosed)
+	}
+
+	// 连接失败时保留原客户端
+	unreachable := testRedisOptions(RedisStandalone, "127.0.0.1:1")
+	unreachable.DialTimeout = 100 * time.Millisecond
+	unreachable.MaxRetries = -1
+	if err := manager.UpdateTenant(ctx, "tenant1", unreachable); err == nil {
+		t.Errorf("UpdateTenant() unreachable error = nil, want error")
+	}
+	if got := clientAddr(t, manager, "tenant1"); got != second.Addr() {
+		t.Errorf("GetClient() after failed update addr = %v, want %v", got, second.Addr())
+	}
+	if err := manager.AddTenant(ctx, "tenant2", unreachable); err == nil {
+		t.Errorf("AddTenant() unreachable error = nil, want error")
+	}
+
+	if err := manager.RemoveTenant("tenant1"); err != nil {
+		t.Fatalf("RemoveTenant() error = %v", err)
+	}
+	if got := clientAddr(t, manager, "tenant1"); got != defaultServer.Addr() {
+		t.Errorf("GetClient() after remove addr = %v, want default %v", got, defaultServer.Addr())
+	}
+	if err := manager.RemoveTenant("tenant1"); !errors.Is(err, ErrUnknownRedisTenant) {
+		t.Errorf("RemoveTenant() again error = %v, want %v", err, ErrUnknownRedisTenant)
+	}
+	if err := manager.UpdateTenant(ctx, "tenant1", testRedisOptions(RedisStandalone, second.Addr())); !errors.Is(err, ErrUnknownRedisTenant) {
+		t.Errorf("UpdateTenant() removed tenant error = %v, want %v", err, ErrUnknownRedisTenant)
+	}
+}
+
+func TestRedisManager_StrictMode(t *testing.T) {
+	manager, defaultServer := newTestRedisManager(t, true)
+	ctx := context.Background()
+
+	if _, err := manager.GetClient(ctx, "tenant1"); !errors.Is(err, ErrUnknownRedisTenant) {
+		t.Errorf("GetClient() error = %v, want %v", err, ErrUnknownRedisTenant)
+	}
+	if got := clientAddr(t, manager, ""); got != defaultServer.Addr() {
+		t.Errorf("GetClient() empty tenant addr = %v, want default %v", got, defaultServer.Addr())
+	}
+
+	helper := NewRedisHelper(manager)
+	tenantCtx := context.WithValue(ctx, consts.TenantID, "tenant1")
+	if err := helper.Set(tenantCtx, "key", "value", time.Minute); !errors.Is(err, ErrUnknownRedisTenant) {
+		t.Errorf("Set() error = %v, want %v", err, ErrUnknownRedisTenant)
+	}
+
+	server := newFakeRedis(t)
+	if err := manager.AddTenant(ctx, "tenant1", testRedisOptions(RedisStandalone, server.Addr())); err != nil {
+		t.Fatalf("AddTenant() error = %v", err)
+	}
+	if err := helper.Set(tenantCtx, "key", "value", 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	value, err := helper.Get(tenantCtx, "key")
+	if err != nil || value != "value" {
+		t.Errorf("Get() = %v, %v, want %v", value, err, "value")
+	}
+	server.mutex.Lock()
+	_, ok := server.data["tenant1:key"]
+	server.mutex.Unlock()
+	if !ok {
+		t.Errorf("tenant server has no key %v", "tenant1:key")
+	}
+}
+
+func TestRedisManager_ClusterMode(t *testing.T) {
+	manager, defaultServer := newTestRedisManager(t, false)
+	ctx := context.Background()
+
+	cluster := newFakeRedis(t)
+	if err := manager.AddTenant(ctx, "tenant1", testRedisOptions(RedisCluster, cluster.Addr())); err != nil {
+		t.Fatalf("AddTenant() error = %v", err)
+	}
+	client, err := manager.GetClient(ctx, "tenant1")
+	if err != nil {
+		t.Fatalf("GetClient() error = %v", err)
+	}
+	if _, ok := client.(*redis.ClusterClient); !ok {
+		t.Errorf("GetClient() = %T, want *redis.ClusterClient", client)
+	}
+
+	tests := []struct {
+		tenantID string
+		want     string
+	}{
+		{tenantID: "tenant1", want: "{tenant1}:key"},
+		{tenantID: "tenant2", want: "tenant2:key"},
+		{tenantID: "", want: "key"},
+	}
+	for _, tt := range tests {
+		tenantCtx := context.WithValue(ctx, consts.TenantID, tt.tenantID)
+		if got := manager.WithTenantPrefix(tenantCtx, "key"); got != tt.want {
+			t.Errorf("WithTenantPrefix(%q) = %v, want %v", tt.tenantID, got, tt.want)
+		}
+		if got := manager.WithTenantPrefix(tools.WithTenant(ctx, tt.tenantID), "key"); got != tt.want {
+			t.Errorf("WithTenantPrefix(tools.WithTenant(%q)) = %v, want %v", tt.tenantID, got, tt.want)
+		}
+	}
+
+	helper := NewRedisHelper(manager)
+	tenantCtx := context.WithValue(ctx, consts.TenantID, "tenant1")
+	if err := helper.Set(tenantCtx, "key", "value", 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	cluster.mutex.Lock()
+	_, ok := cluster.data["{tenant1}:key"]
+	cluster.mutex.Unlock()
+	if !ok {
+		t.Errorf("cluster server has no key %v", "{tenant1}:key")
+	}
+
+	// 哨兵模式缺少MasterName、未知模式均无法创建客户端
+	for _, options := range []*RedisOptions{
+		testRedisOptions(RedisSentinel, defaultServer.Addr()),
+		testRedisOptions("replica", defaultServer.Addr()),
+	} {
+		if err := manager.AddTenant(ctx, "tenant2", options); err == nil {
+			t.Errorf("AddTenant(%v) error = nil, want error", options.Mode)
+		}
+	}
+}
+
+func TestRedisManager_TenantKeyspace(t *testing.T) {
+	manager, defaultServer := newTestRedisManager(t, false)
+	manager.(*tenantRedisManager).config.ScanCount = 3
+	ctx := context.Background()
+
+	helper := NewRedisHelper(manager)
+	for _, tenantID := range []string{"tenant1", "tenant10", "t*"} {
+		tenantCtx := tools.WithTenant(ctx, tenantID)
+		for i := 0; i < 5; i++ {
+			if err := helper.Set(tenantCtx, fmt.Sprintf("key%d", i), "value", 0); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+		}
+	}
+	if err := helper.Set(tools.WithTenant(ctx, "t*"), "extra", "value", 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	keys, err := manager.ListTenantKeys(ctx, "tenant1")
+	if err != nil {
+		t.Fatalf("ListTenantKeys() error = %v", err)
+	}
+	sort.Strings(keys)
+	if len(keys) != 5 || keys[0] != "tenant1:key0" {
+		t.Errorf("ListTenantKeys() = %v, want 5 keys of tenant1", keys)
+	}
+
+	// 租户ID中的通配符按字面匹配
+	if count, err := manager.CountTenantKeys(ctx, "t*"); err != nil || count != 6 {
+		t.Errorf("CountTenantKeys() = %v, %v, want %v", count, err, 6)
+	}
+	// 包含分隔符的租户ID会与其他租户的前缀重叠，注册和按租户遍历时拒绝
+	if err := manager.AddTenant(ctx, "tenant1:b", testRedisOptions(RedisStandalone, newFakeRedis(t).Addr())); !errors.Is(err, ErrInvalidRedisTenant) {
+		t.Errorf("AddTenant() with separator error = %v, want %v", err, ErrInvalidRedisTenant)
+	}
+	if _, err := manager.DeleteTenantKeys(ctx, "tenant1:b"); !errors.Is(err, ErrInvalidRedisTenant) {
+		t.Errorf("DeleteTenantKeys() with separator error = %v, want %v", err, ErrInvalidRedisTenant)
+	}
+	wantUsage := int64(5 * len("tenant1:key0value"))
+	if usage, err := manager.TenantMemoryUsage(ctx, "tenant1"); err != nil || usage != wantUsage {
+		t.Errorf("TenantMemoryUsage() = %v, %v, want %v", usage, err, wantUsage)
+	}
+
+	stop := errors.New("stop")
+	batches := 0
+	err = manager.ScanTenantKeys(ctx, "tenant1", func(keys []string) error {
+		batches++
+		return stop
+	})
+	if !errors.Is(err, stop) || batches != 1 {
+		t.Errorf("ScanTenantKeys() = %v after %v batches, want %v after 1", err, batches, stop)
+	}
+
+	if deleted, err := manager.DeleteTenantKeys(ctx, "tenant1"); err != nil || deleted != 5 {
+		t.Errorf("DeleteTenantKeys() = %v, %v, want %v", deleted, err, 5)
+	}
+	defaultServer.mutex.Lock()
+	remaining := len(defaultServer.data)
+	defaultServer.mutex.Unlock()
+	if remaining != 11 {
+		t.Errorf("remaining keys = %v, want %v", remaining, 11)
+	}
+
+	// 集群模式下遍历主节点，注销后移除租户客户端
+	cluster := newFakeRedis(t)
+	if err := manager.AddTenant(ctx, "tenant3", testRedisOptions(RedisCluster, cluster.Addr())); err != nil {
+		t.Fatalf("AddTenant() error = %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := helper.Set(tools.WithTenant(ctx, "tenant3"), fmt.Sprintf("key%d", i), "value", 0); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+	if count, err := manager.CountTenantKeys(ctx, "tenant3"); err != nil || count != 4 {
+		t.Errorf("CountTenantKeys() cluster = %v, %v, want %v", count, err, 4)
+	}
+	if err := RedisDeprovisionHook(manager)(ctx, "tenant3"); err != nil {
+		t.Fatalf("RedisDeprovisionHook() error = %v", err)
+	}
+	cluster.mutex.Lock()
+	remaining = len(cluster.data)
+	cluster.mutex.Unlock()
+	if remaining != 0 {
+		t.Errorf("cluster remaining keys = %v, want %v", remaining, 0)
+	}
+	if err := manager.RemoveTenant("tenant3"); !errors.Is(err, ErrUnknownRedisTenant) {
+		t.Errorf("RemoveTenant() after hook error = %v, want %v", err, ErrUnknownRedisTenant)
+	}
+}
+
+func TestRedisManager_Instrumentation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	manager, _ := newTestRedisManager(t, false, func(config *RedisConfig) {
+		config.EnableInstrumentation = true
+		config.MaxMetricTenants = 1
+	})
+	ctx := context.Background()
+	if err := manager.AddTenant(ctx, "tenant1", testRedisOptions(RedisStandalone, newFakeRedis(t).Addr())); err != nil {
+		t.Fatalf("AddTenant() error = %v", err)
+	}
+	if err := manager.AddTenant(ctx, "tenant2", testRedisOptions(RedisStandalone, newFakeRedis(t).Addr())); err != nil {
+		t.Fatalf("AddTenant() error = %v", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := manager.RegisterMetrics(registry); err != nil {
+		t.Fatalf("RegisterMetrics() error = %v", err)
+	}
+
+	helper := NewRedisHelper(manager)
+	for _, tenantID := range []string{"tenant1", "tenant2", "tenant3"} {
+		if err := helper.Set(tools.WithTenant(ctx, tenantID), "key", "value", 0); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+	if _, err := helper.Get(ctx, "missing"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if _, err := manager.DeleteTenantKeys(ctx, "tenant1"); err != nil {
+		t.Fatalf("DeleteTenantKeys() error = %v", err)
+	}
+
+	gather := func() (map[string]uint64, map[string]bool) {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Gather() error = %v", err)
+		}
+		durations := make(map[string]uint64)
+		poolTenants := make(map[string]bool)
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				labels := make(map[string]string)
+				for _, label := range metric.GetLabel() {
+					labels[label.GetName()] = label.GetValue()
+				}
+				switch family.GetName() {
+				case "tenant_redis_command_duration_seconds":
+					durations[labels["command"]+"/"+labels["tenant"]] += metric.GetHistogram().GetSampleCount()
+				case "tenant_redis_pool_hits_total":
+					poolTenants[labels["tenant"]] = true
+				}
+			}
+		}
+		return durations, poolTenants
+	}
+	durations, poolTenants := gather()
+
+	// tenant1最先出现占用唯一的租户标签，其他租户合并到_other
+	want := map[string]uint64{"set/tenant1": 1, "set/_other": 2, "get/_default": 1, "pipeline/tenant1": 1}
+	for key, count := range want {
+		if durations[key] != count {
+			t.Errorf("tenant_redis_command_duration_seconds{%v} count = %v, want %v", key, durations[key], count)
+		}
+	}
+	// 连接池统计与命令耗时共用租户标签，新增排序靠前的租户不会改变已分配的标签
+	if err := manager.AddTenant(ctx, "tenant0", testRedisOptions(RedisStandalone, newFakeRedis(t).Addr())); err != nil {
+		t.Fatalf("AddTenant() error = %v", err)
+	}
+	_, poolTenants = gather()
+	wantPool := map[string]bool{defaultTenantLabel: true, "tenant1": true, otherTenantsLabel: true}
+	if !reflect.DeepEqual(poolTenants, wantPool) {
+		t.Errorf("tenant_redis_pool_hits_total tenants = %v, want %v", poolTenants, wantPool)
+	}
+
+	spans := make(map[string]int)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()]++
+	}
+	if spans["set"] != 3 || spans["redis.pipeline"] != 1 {
+		t.Errorf("spans = %v, want 3 set and 1 pipeline", spans)
+	}
+}
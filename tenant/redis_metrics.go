@@ -0,0 +1,278 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/onebids/onecommon/tools"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// redisTracerName Redis追踪使用的Tracer名称
+	redisTracerName = "github.com/onebids/onecommon/tenant"
+
+	// defaultTenantLabel 默认客户端和没有租户的命令使用的标识
+	defaultTenantLabel = "_default"
+
+	// pipelineCommand 管道命令在指标中使用的命令名
+	pipelineCommand = "pipeline"
+)
+
+// redisMetrics Redis命令耗时指标
+type redisMetrics struct {
+	duration *prometheus.HistogramVec
+	// 与连接池统计共用的租户标签
+	labels *tenantLabels
+}
+
+// newRedisMetrics 创建Redis命令耗时指标
+func newRedisMetrics(labels *tenantLabels) *redisMetrics {
+	return &redisMetrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "tenant_redis_command_duration_seconds",
+			Help:    "Duration of Redis commands, pipelines are recorded as one observation.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"command", "tenant"}),
+		labels: labels,
+	}
+}
+
+// redisTenantLabel 获取租户的指标标签，默认客户端使用_default且不占用租户标签数量
+func redisTenantLabel(labels *tenantLabels, tenantID string) string {
+	if tenantID == "" {
+		return defaultTenantLabel
+	}
+	return labels.label(tenantID)
+}
+
+// redisHook 记录Redis命令的追踪和耗时的go-redis钩子
+type redisHook struct {
+	// 客户端所属租户，上下文中没有租户ID时使用
+	tenantID string
+	metrics  *redisMetrics
+	tracer   trace.Tracer
+}
+
+// newRedisHook 创建租户客户端的钩子
+func newRedisHook(tenantID string, metrics *redisMetrics) *redisHook {
+	return &redisHook{
+		tenantID: tenantID,
+		metrics:  metrics,
+		tracer:   otel.Tracer(redisTracerName),
+	}
+}
+
+// DialHook 实现redis.Hook接口
+func (h *redisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, span := h.tracer.Start(ctx, "redis.dial", trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", "redis"), attribute.String("net.peer.name", addr)))
+		defer span.End()
+
+		conn, err := next(ctx, network, addr)
+		recordSpanError(span, err)
+		return conn, err
+	}
+}
+
+// ProcessHook 实现redis.Hook接口
+func (h *redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		tenantID := h.tenant(ctx)
+		ctx, span := h.tracer.Start(ctx, cmd.FullName(), trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.String("db.operation", cmd.Name()),
+				attribute.String("tenant.id", tenantID),
+			))
+		defer span.End()
+
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.observe(cmd.Name(), tenantID, time.Since(start))
+		recordSpanError(span, err)
+		return err
+	}
+}
+
+// ProcessPipelineHook 实现redis.Hook接口
+func (h *redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		tenantID := h.tenant(ctx)
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		ctx, span := h.tracer.Start(ctx, "redis.pipeline", trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.String("db.operation", strings.Join(names, " ")),
+				attribute.Int("db.redis.num_cmd", len(cmds)),
+				attribute.String("tenant.id", tenantID),
+			))
+		defer span.End()
+
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.observe(pipelineCommand, tenantID, time.Since(start))
+		recordSpanError(span, err)
+		return err
+	}
+}
+
+// tenant 获取命令所属的租户，默认客户端被多个租户共用，优先使用上下文中的租户ID
+func (h *redisHook) tenant(ctx context.Context) string {
+	if tenantID, ok := tools.ResolveTenant(ctx); ok {
+		return tenantID
+	}
+	return h.tenantID
+}
+
+// observe 记录命令耗时
+func (h *redisHook) observe(command, tenantID string, elapsed time.Duration) {
+	if h.metrics == nil {
+		return
+	}
+	h.metrics.duration.WithLabelValues(command, redisTenantLabel(h.metrics.labels, tenantID)).Observe(elapsed.Seconds())
+}
+
+// recordSpanError 记录命令错误，key不存在不算错误
+func recordSpanError(span trace.Span, err error) {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// redisPoolStats 单个客户端的连接池统计
+type redisPoolStats struct {
+	// 默认客户端为空
+	tenantID string
+	stats    redis.PoolStats
+}
+
+// poolStats 获取所有客户端的连接池统计，默认客户端在最前，租户按ID排序
+func (m *tenantRedisManager) poolStats() []redisPoolStats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]redisPoolStats, 0, len(m.clients)+1)
+	if m.defaultClient != nil {
+		result = append(result, redisPoolStats{stats: *m.defaultClient.PoolStats()})
+	}
+
+	tenantIDs := make([]string, 0, len(m.clients))
+	for tenantID := range m.clients {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+	for _, tenantID := range tenantIDs {
+		result = append(result, redisPoolStats{tenantID: tenantID, stats: *m.clients[tenantID].PoolStats()})
+	}
+	return result
+}
+
+// redisPoolCollector Redis连接池统计采集器
+type redisPoolCollector struct {
+	stats  func() []redisPoolStats
+	labels *tenantLabels
+
+	hits       *prometheus.Desc
+	misses     *prometheus.Desc
+	timeouts   *prometheus.Desc
+	staleConns *prometheus.Desc
+	totalConns *prometheus.Desc
+	idleConns  *prometheus.Desc
+}
+
+// newRedisPoolCollector 创建连接池统计采集器
+// 租户标签先到先得，超过上限的租户合并到_other标签，防止标签基数过大
+func newRedisPoolCollector(stats func() []redisPoolStats, tenants *tenantLabels) *redisPoolCollector {
+	labels := []string{"tenant"}
+	return &redisPoolCollector{
+		stats:  stats,
+		labels: tenants,
+		hits: prometheus.NewDesc("tenant_redis_pool_hits_total",
+			"Number of times a free connection was found in the pool.", labels, nil),
+		misses: prometheus.NewDesc("tenant_redis_pool_misses_total",
+			"Number of times a free connection was not found in the pool.", labels, nil),
+		timeouts: prometheus.NewDesc("tenant_redis_pool_timeouts_total",
+			"Number of times a wait for a connection timed out.", labels, nil),
+		staleConns: prometheus.NewDesc("tenant_redis_pool_stale_connections_total",
+			"Number of stale connections removed from the pool.", labels, nil),
+		totalConns: prometheus.NewDesc("tenant_redis_pool_connections",
+			"Number of connections in the pool.", labels, nil),
+		idleConns: prometheus.NewDesc("tenant_redis_pool_idle_connections",
+			"Number of idle connections in the pool.", labels, nil),
+	}
+}
+
+// Describe 实现prometheus.Collector接口
+func (c *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.staleConns
+	ch <- c.totalConns
+	ch <- c.idleConns
+}
+
+// Collect 实现prometheus.Collector接口
+func (c *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	var other redis.PoolStats
+	hasOther := false
+	for _, item := range c.stats() {
+		label := redisTenantLabel(c.labels, item.tenantID)
+		if label == otherTenantsLabel {
+			other.Hits += item.stats.Hits
+			other.Misses += item.stats.Misses
+			other.Timeouts += item.stats.Timeouts
+			other.StaleConns += item.stats.StaleConns
+			other.TotalConns += item.stats.TotalConns
+			other.IdleConns += item.stats.IdleConns
+			hasOther = true
+			continue
+		}
+		c.collect(ch, label, item.stats)
+	}
+	if hasOther {
+		c.collect(ch, otherTenantsLabel, other)
+	}
+}
+
+// collect 输出单个客户端的连接池指标
+func (c *redisPoolCollector) collect(ch chan<- prometheus.Metric, tenantID string, stats redis.PoolStats) {
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits), tenantID)
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses), tenantID)
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.Timeouts), tenantID)
+	ch <- prometheus.MustNewConstMetric(c.staleConns, prometheus.CounterValue, float64(stats.StaleConns), tenantID)
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stats.TotalConns), tenantID)
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stats.IdleConns), tenantID)
+}
+
+// RegisterMetrics 将连接池统计注册为Prometheus指标，启用EnableInstrumentation时同时注册命令耗时
+// registerer为nil时使用mtl.Registry
+func (m *tenantRedisManager) RegisterMetrics(registerer prometheus.Registerer) error {
+	registerer, err := metricsRegisterer(registerer)
+	if err != nil {
+		return err
+	}
+	if err := registerer.Register(newRedisPoolCollector(m.poolStats, m.labels)); err != nil {
+		return err
+	}
+	if m.metrics != nil {
+		return registerer.Register(m.metrics.duration)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/onebids/onecommon/tools"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrMissingTenant 严格模式下上下文中没有租户ID
+var ErrMissingTenant = errors.New("tenant ID missing from context, use WithTenant or WithSystemScope")
+
+// systemScopeKey 跨租户访问的上下文键
+type systemScopeKey struct{}
+
+// WithSystemScope 创建跨租户访问的上下文，用于管理后台等需要访问所有租户数据的场景
+// reason说明访问原因，不能为空，每次获取连接都会记录日志和监控指标，reason只记录在日志中
+// 跨租户访问优先于上下文中的租户ID
+func WithSystemScope(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, systemScopeKey{}, reason)
+}
+
+// GetSystemScope 获取上下文中的跨租户访问原因
+func GetSystemScope(ctx context.Context) (string, bool) {
+	reason, ok := ctx.Value(systemScopeKey{}).(string)
+	return reason, ok && reason != ""
+}
+
+// newSystemScopeCounter 创建跨租户访问计数器
+// reason是任意字符串，不作为标签，防止标签基数无限增长
+func newSystemScopeCounter(name string) prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "tenant_system_scope_total",
+		Help:        "Total number of cross-tenant database sessions opened with a system scope.",
+		ConstLabels: prometheus.Labels{"manager": name},
+	})
+}
+
+// recordSystemScope 记录跨租户访问日志和指标
+func recordSystemScope(ctx context.Context, counter prometheus.Counter, reason string) {
+	klog.CtxWarnf(ctx, "system scope database access, reason: %s, user: %s, trace: %s",
+		reason, tools.GetUserID(ctx), tools.GetTraceID(ctx))
+	counter.Inc()
+}
@@ -0,0 +1,414 @@
+package tenant
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrTenantNotEmpty 导入的目标租户已有数据
+	ErrTenantNotEmpty = errors.New("tenant already has data")
+
+	// ErrArchiveSchemaTooNew 归档的数据结构版本高于目标库
+	ErrArchiveSchemaTooNew = errors.New("archive schema version is newer than target database")
+
+	// ErrArchiveCorrupted 归档文件的行数或校验和与manifest不一致
+	ErrArchiveCorrupted = errors.New("archive is corrupted")
+)
+
+const (
+	// archiveFormatVersion 归档格式版本
+	archiveFormatVersion = 1
+
+	// archiveManifestFile 归档中manifest的文件名
+	archiveManifestFile = "manifest.json"
+)
+
+// ArchiveConfig 租户数据导出导入配置
+type ArchiveConfig struct {
+	// 需要导出导入的模型，只能有一个主键，字段级隔离时必须带有租户ID字段
+	// 按外键依赖顺序排列，导入时按导出顺序写入
+	Models []interface{}
+
+	// 每批读取或写入的行数
+	// 默认值: 500
+	BatchSize int
+
+	// 数据结构版本，导出时写入manifest，导入时归档版本不能高于该版本
+	// 默认值: 0 (数据库级隔离且配置了Migrator时使用租户库已执行的最新迁移版本，否则不检查)
+	SchemaVersion int64
+}
+
+// NewDefaultArchiveConfig 创建带有默认值的导出导入配置
+func NewDefaultArchiveConfig() *ArchiveConfig {
+	return &ArchiveConfig{
+		BatchSize: 500,
+	}
+}
+
+// normalizeArchiveConfig 填充导出导入配置的默认值
+func normalizeArchiveConfig(config *ArchiveConfig) *ArchiveConfig {
+	if config == nil {
+		return NewDefaultArchiveConfig()
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = NewDefaultArchiveConfig().BatchSize
+	}
+	return config
+}
+
+// ArchiveManifest 归档描述，保存在归档的manifest.json中
+type ArchiveManifest struct {
+	FormatVersion int            `json:"format_version"`
+	TenantID      string         `json:"tenant_id"`
+	SchemaVersion int64          `json:"schema_version"`
+	ExportedAt    time.Time      `json:"exported_at"`
+	Tables        []ArchiveTable `json:"tables"`
+}
+
+// ArchiveTable 归档中的一张表，每行一个以列名为键的JSON对象
+type ArchiveTable struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Rows int64  `json:"rows"`
+	// 文件内容的SHA-256
+	Checksum string `json:"checksum"`
+}
+
+// ExportTenant 将租户的数据导出为zip归档写入w
+// 每个模型导出为tables目录下的一个JSON Lines文件，manifest.json记录租户、数据结构版本和各表行数
+func (m *FieldDBManager) ExportTenant(ctx context.Context, tenantID string, w io.Writer, config *ArchiveConfig) (*ArchiveManifest, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant ID cannot be empty")
+	}
+	config = normalizeArchiveConfig(config)
+
+	source, err := m.dataEndpoint(ctx, "tenant export")
+	if err != nil {
+		return nil, err
+	}
+	return exportTenant(source, tenantID, w, config, config.SchemaVersion)
+}
+
+// ImportTenant 将ExportTenant导出的归档导入到租户，租户在各模型中不能已有数据
+// 导入在一个事务中执行，租户ID设置为tenantID，主键保持不变
+func (m *FieldDBManager) ImportTenant(ctx context.Context, tenantID string, r io.ReaderAt, size int64, config *ArchiveConfig) (*ArchiveManifest, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant ID cannot be empty")
+	}
+	config = normalizeArchiveConfig(config)
+
+	target, err := m.dataEndpoint(ctx, "tenant import")
+	if err != nil {
+		return nil, err
+	}
+	return importTenant(target, tenantID, r, size, config, config.SchemaVersion)
+}
+
+// ExportTenant 将租户库的数据导出为zip归档写入w，格式与FieldDBManager.ExportTenant相同
+func (m *TenantDBManager) ExportTenant(ctx context.Context, tenantID string, w io.Writer, config *ArchiveConfig) (*ArchiveManifest, error) {
+	config = normalizeArchiveConfig(config)
+
+	source, err := m.dataEndpoint(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	version, err := m.schemaVersion(ctx, tenantID, config)
+	if err != nil {
+		return nil, err
+	}
+	return exportTenant(source, tenantID, w, config, version)
+}
+
+// ImportTenant 将归档导入到租户库，租户库需已开通且各模型中没有数据
+func (m *TenantDBManager) ImportTenant(ctx context.Context, tenantID string, r io.ReaderAt, size int64, config *ArchiveConfig) (*ArchiveManifest, error) {
+	config = normalizeArchiveConfig(config)
+
+	target, err := m.dataEndpoint(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	version, err := m.schemaVersion(ctx, tenantID, config)
+	if err != nil {
+		return nil, err
+	}
+	return importTenant(target, tenantID, r, size, config, version)
+}
+
+// schemaVersion 获取租户库的数据结构版本
+func (m *TenantDBManager) schemaVersion(ctx context.Context, tenantID string, config *ArchiveConfig) (int64, error) {
+	if config.SchemaVersion > 0 {
+		return config.SchemaVersion, nil
+	}
+	if _, err := m.getMigrator(); err != nil {
+		return 0, nil
+	}
+
+	statuses, err := m.MigrationStatus(ctx, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	for _, status := range statuses {
+		if status.Applied && status.Version > version {
+			version = status.Version
+		}
+	}
+	return version, nil
+}
+
+// exportTenant 按主键分批读取各模型的数据并写入归档
+func exportTenant(source dataEndpoint, tenantID string, w io.Writer, config *ArchiveConfig, version int64) (*ArchiveManifest, error) {
+	schemas, err := parseTenantModels(source.db, config.Models, source.tenantField)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &ArchiveManifest{
+		FormatVersion: archiveFormatVersion,
+		TenantID:      tenantID,
+		SchemaVersion: version,
+		ExportedAt:    time.Now().UTC(),
+	}
+
+	archive := zip.NewWriter(w)
+	for _, s := range schemas {
+		table, err := exportTable(archive, source, s, tenantID, config.BatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export table %s for tenant %s: %w", s.Table, tenantID, err)
+		}
+		manifest.Tables = append(manifest.Tables, *table)
+	}
+
+	file, err := archive.Create(archiveManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write archive manifest: %w", err)
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to write archive manifest: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// exportTable 将一张表的数据写入归档，每行一个以列名为键的JSON对象
+func exportTable(archive *zip.Writer, source dataEndpoint, s *schema.Schema, tenantID string, batchSize int) (*ArchiveTable, error) {
+	table := &ArchiveTable{Name: s.Table, File: "tables/" + s.Table + ".jsonl"}
+	file, err := archive.Create(table.File)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := source.db.Statement.Context
+	checksum := sha256.New()
+	encoder := json.NewEncoder(io.MultiWriter(file, checksum))
+	records := reflect.New(reflect.SliceOf(s.ModelType))
+	err = source.scope(s, tenantID).FindInBatches(records.Interface(), batchSize, func(tx *gorm.DB, batch int) error {
+		rows := records.Elem()
+		for i := 0; i < rows.Len(); i++ {
+			row := make(map[string]interface{}, len(s.DBNames))
+			for _, name := range s.DBNames {
+				row[name], _ = s.FieldsByDBName[name].ValueOf(ctx, rows.Index(i))
+			}
+			if err := encoder.Encode(row); err != nil {
+				return err
+			}
+		}
+		table.Rows += int64(rows.Len())
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	table.Checksum = hex.EncodeToString(checksum.Sum(nil))
+	return table, nil
+}
+
+// importTenant 校验归档后在一个事务中逐表流式写入
+func importTenant(target dataEndpoint, tenantID string, r io.ReaderAt, size int64, config *ArchiveConfig, version int64) (*ArchiveManifest, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	manifest, err := readManifest(files[archiveManifestFile])
+	if err != nil {
+		return nil, err
+	}
+	if manifest.FormatVersion != archiveFormatVersion {
+		return nil, fmt.Errorf("unsupported archive format version %d", manifest.FormatVersion)
+	}
+	if version > 0 && manifest.SchemaVersion > version {
+		return nil, fmt.Errorf("%w: archive %d, target %d", ErrArchiveSchemaTooNew, manifest.SchemaVersion, version)
+	}
+
+	schemas, err := parseTenantModels(target.db, config.Models, target.tenantField)
+	if err != nil {
+		return nil, err
+	}
+	schemasByTable := make(map[string]*schema.Schema, len(schemas))
+	for _, s := range schemas {
+		var count int64
+		if err := target.scope(s, tenantID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("%w: %s has %d rows in %s", ErrTenantNotEmpty, tenantID, count, s.Table)
+		}
+		schemasByTable[s.Table] = s
+	}
+
+	err = target.db.Transaction(func(tx *gorm.DB) error {
+		txTarget := dataEndpoint{db: tx, tenantField: target.tenantField}
+		for _, table := range manifest.Tables {
+			s, ok := schemasByTable[table.Name]
+			if !ok {
+				return fmt.Errorf("archive table %s has no configured model", table.Name)
+			}
+			file, ok := files[table.File]
+			if !ok {
+				return fmt.Errorf("%w: missing file %s", ErrArchiveCorrupted, table.File)
+			}
+			if err := importTable(txTarget, s, file, table, tenantID, config.BatchSize); err != nil {
+				return fmt.Errorf("failed to import table %s for tenant %s: %w", table.Name, tenantID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// readManifest 读取归档的manifest
+func readManifest(file *zip.File) (*ArchiveManifest, error) {
+	if file == nil {
+		return nil, fmt.Errorf("%w: missing %s", ErrArchiveCorrupted, archiveManifestFile)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive manifest: %w", err)
+	}
+	defer reader.Close()
+
+	var manifest ArchiveManifest
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to read archive manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// importTable 逐行解码表文件并分批写入，结束后校验行数和校验和
+func importTable(target dataEndpoint, s *schema.Schema, file *zip.File, table ArchiveTable, tenantID string, batchSize int) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	ctx := target.db.Statement.Context
+	checksum := sha256.New()
+	decoder := json.NewDecoder(io.TeeReader(reader, checksum))
+	records := reflect.New(reflect.SliceOf(s.ModelType))
+
+	var rows int64
+	for {
+		var row map[string]json.RawMessage
+		if err := decoder.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%w: row %d: %v", ErrArchiveCorrupted, rows+1, err)
+		}
+
+		record, err := decodeRecord(ctx, s, row)
+		if err != nil {
+			return fmt.Errorf("%w: row %d: %v", ErrArchiveCorrupted, rows+1, err)
+		}
+		if target.tenantField != "" {
+			if err := s.FieldsByDBName[target.tenantField].Set(ctx, record, tenantID); err != nil {
+				return err
+			}
+		}
+		records.Elem().Set(reflect.Append(records.Elem(), record))
+		rows++
+
+		if records.Elem().Len() >= batchSize {
+			if err := insertRecords(target, records); err != nil {
+				return err
+			}
+		}
+	}
+	if err := insertRecords(target, records); err != nil {
+		return err
+	}
+
+	return verifyArchiveTable(table, rows, checksum)
+}
+
+// decodeRecord 按模型字段的类型解码一行数据，模型中不存在的列被忽略
+func decodeRecord(ctx context.Context, s *schema.Schema, row map[string]json.RawMessage) (reflect.Value, error) {
+	record := reflect.New(s.ModelType).Elem()
+	for name, raw := range row {
+		field, ok := s.FieldsByDBName[name]
+		if !ok {
+			continue
+		}
+		value := reflect.New(field.FieldType)
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return record, fmt.Errorf("column %s: %w", name, err)
+		}
+		if err := field.Set(ctx, record, value.Elem().Interface()); err != nil {
+			return record, fmt.Errorf("column %s: %w", name, err)
+		}
+	}
+	return record, nil
+}
+
+// insertRecords 写入一批记录后清空，不执行模型钩子也不写入关联
+func insertRecords(target dataEndpoint, records reflect.Value) error {
+	if records.Elem().Len() == 0 {
+		return nil
+	}
+	err := target.db.Session(&gorm.Session{SkipHooks: true}).
+		Omit(clause.Associations).
+		Create(records.Interface()).Error
+	if err != nil {
+		return err
+	}
+	records.Elem().SetLen(0)
+	return nil
+}
+
+// verifyArchiveTable 校验导入的行数和文件校验和与manifest一致
+func verifyArchiveTable(table ArchiveTable, rows int64, checksum hash.Hash) error {
+	if rows != table.Rows {
+		return fmt.Errorf("%w: %s has %d rows, manifest has %d", ErrArchiveCorrupted, table.File, rows, table.Rows)
+	}
+	if sum := hex.EncodeToString(checksum.Sum(nil)); sum != table.Checksum {
+		return fmt.Errorf("%w: %s checksum %s, manifest has %s", ErrArchiveCorrupted, table.File, sum, table.Checksum)
+	}
+	return nil
+}
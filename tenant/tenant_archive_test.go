@@ -0,0 +1,121 @@
+package tenant
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestFieldDBManager_ExportImportTenant(t *testing.T) {
+	source := newTestFieldDBManager(t)
+	seedMoveTenants(t, source)
+	config := &ArchiveConfig{Models: []interface{}{&testFieldUser{}, &testFieldOrder{}}, BatchSize: 2}
+
+	var archive bytes.Buffer
+	manifest, err := source.ExportTenant(context.Background(), "tenant-a", &archive, config)
+	if err != nil {
+		t.Fatalf("ExportTenant() error = %v", err)
+	}
+	if len(manifest.Tables) != 2 || manifest.Tables[0].Rows != 5 || manifest.Tables[1].Rows != 1 {
+		t.Errorf("ExportTenant() tables = %+v, want 5 users and 1 order", manifest.Tables)
+	}
+
+	// 导入到另一个共享库中的新租户
+	target := newTestFieldDBManager(t)
+	reader := bytes.NewReader(archive.Bytes())
+	if _, err := target.ImportTenant(context.Background(), "tenant-c", reader, reader.Size(), config); err != nil {
+		t.Fatalf("ImportTenant() error = %v", err)
+	}
+
+	db, err := target.GetDB(WithTenant(context.Background(), "tenant-c"))
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	var users []testFieldUser
+	if err := db.Order("id").Find(&users).Error; err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(users) != 5 || users[0].Name != "a1" || users[0].TenantID != "tenant-c" {
+		t.Errorf("imported users = %+v, want 5 users of tenant-c starting with a1", users)
+	}
+
+	if _, err := target.ImportTenant(context.Background(), "tenant-c", reader, reader.Size(), config); !errors.Is(err, ErrTenantNotEmpty) {
+		t.Errorf("ImportTenant() again error = %v, want %v", err, ErrTenantNotEmpty)
+	}
+
+	// 导入到独立库
+	dbConfig := NewDefaultDBConfig()
+	dbConfig.Dialect = SQLite
+	dbConfig.DSNTemplate = filepath.Join(t.TempDir(), "%s.db")
+	dbConfig.EnableTracing = false
+	dbConfig.MigrateFunc = func(db *gorm.DB) error {
+		return db.AutoMigrate(&testFieldUser{}, &testFieldOrder{})
+	}
+	dedicated := NewTenantDBManager(dbConfig)
+	t.Cleanup(dedicated.CloseAll)
+	if _, err := dedicated.ImportTenant(context.Background(), "tenant-a", reader, reader.Size(), config); err != nil {
+		t.Fatalf("ImportTenant() dedicated error = %v", err)
+	}
+	tenantDB, err := dedicated.GetDB("tenant-a")
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	var orders []testFieldOrder
+	if err := tenantDB.Find(&orders).Error; err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(orders) != 1 || orders[0].Item != "book" {
+		t.Errorf("imported orders = %+v, want book", orders)
+	}
+}
+
+func TestTenantDBManager_ExportImportTenant(t *testing.T) {
+	manager := newTestTenantDBManager(t, nil)
+	db, err := manager.GetDB("tenant1")
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	if err := db.Create(&[]testActivity{{Name: "first"}, {Name: "second"}}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	config := &ArchiveConfig{Models: []interface{}{&testActivity{}}}
+	var archive bytes.Buffer
+	manifest, err := manager.ExportTenant(context.Background(), "tenant1", &archive, config)
+	if err != nil {
+		t.Fatalf("ExportTenant() error = %v", err)
+	}
+	if manifest.SchemaVersion != 1 {
+		t.Errorf("ExportTenant() SchemaVersion = %v, want %v", manifest.SchemaVersion, 1)
+	}
+
+	reader := bytes.NewReader(archive.Bytes())
+	if _, err := manager.ImportTenant(context.Background(), "tenant2", reader, reader.Size(), config); err != nil {
+		t.Fatalf("ImportTenant() error = %v", err)
+	}
+	db2, err := manager.GetDB("tenant2")
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	var count int64
+	if err := db2.Model(&testActivity{}).Count(&count).Error; err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("imported activities = %v, want %v", count, 2)
+	}
+
+	// 归档的数据结构版本高于目标库
+	var newer bytes.Buffer
+	if _, err := manager.ExportTenant(context.Background(), "tenant1", &newer, &ArchiveConfig{Models: config.Models, SchemaVersion: 2}); err != nil {
+		t.Fatalf("ExportTenant() error = %v", err)
+	}
+	reader = bytes.NewReader(newer.Bytes())
+	if _, err := manager.ImportTenant(context.Background(), "tenant3", reader, reader.Size(), config); !errors.Is(err, ErrArchiveSchemaTooNew) {
+		t.Errorf("ImportTenant() error = %v, want %v", err, ErrArchiveSchemaTooNew)
+	}
+}
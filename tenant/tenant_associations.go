@@ -0,0 +1,167 @@
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrUnscopedJoin 嵌套关联连接同时经过租户表和共享表，无法统一添加租户条件
+	ErrUnscopedJoin = errors.New("nested join mixes tenant and shared tables")
+
+	// ErrRawJoinNotAllowed 严格模式下使用了无法添加租户条件的字符串连接
+	ErrRawJoinNotAllowed = errors.New("raw join is not allowed on tenant session, join by association or use AllowRawSQL to opt out")
+)
+
+// scopeJoins 为关联连接的每个租户表添加隔离条件
+// 字符串形式的原生连接（如Joins("JOIN orders ON ...")）无法识别表结构，不会添加租户条件，
+// strict为true时返回ErrRawJoinNotAllowed，否则需调用方在ON条件中自行过滤
+func scopeJoins(db *gorm.DB, values []scopeValue, strict bool) error {
+	if db.Statement.Schema == nil {
+		return nil
+	}
+
+	if strict {
+		for _, join := range db.Statement.Joins {
+			if joinRelations(db.Statement.Schema, join.Name) == nil {
+				return fmt.Errorf("%w: %s", ErrRawJoinNotAllowed, join.Name)
+			}
+		}
+	}
+
+	for _, v := range values {
+		if err := scopeJoinsBy(db, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scopeJoinsBy 为包含指定隔离列的关联连接添加条件
+func scopeJoinsBy(db *gorm.DB, v scopeValue) error {
+	condition := clause.Eq{
+		Column: clause.Column{Table: clause.CurrentTable, Name: v.field},
+		Value:  v.value,
+	}
+	for i, join := range db.Statement.Joins {
+		relations := joinRelations(db.Statement.Schema, join.Name)
+		if len(relations) == 0 {
+			continue
+		}
+
+		scoped := 0
+		for _, relation := range relations {
+			if _, ok := relation.FieldSchema.FieldsByDBName[v.field]; ok {
+				scoped++
+			}
+		}
+		if scoped == 0 {
+			continue
+		}
+		// GORM对嵌套连接的每一层使用同一个ON条件
+		if scoped != len(relations) {
+			return fmt.Errorf("%w: %s", ErrUnscopedJoin, join.Name)
+		}
+
+		var exprs []clause.Expression
+		if join.On != nil {
+			exprs = append(exprs, join.On.Exprs...)
+		}
+		if containsExpression(exprs, condition) {
+			continue
+		}
+		db.Statement.Joins[i].On = &clause.Where{Exprs: append(exprs, condition)}
+	}
+	return nil
+}
+
+// joinRelations 解析连接名称对应的关联关系，支持"Manager.Company"形式的嵌套连接
+// 不是关联名称时返回nil
+func joinRelations(s *schema.Schema, name string) []*schema.Relationship {
+	if relation, ok := s.Relationships.Relations[name]; ok {
+		return []*schema.Relationship{relation}
+	}
+
+	var relations []*schema.Relationship
+	current := s.Relationships.Relations
+	for _, part := range strings.Split(name, ".") {
+		relation, ok := current[part]
+		if !ok {
+			return nil
+		}
+		relations = append(relations, relation)
+		current = relation.FieldSchema.Relationships.Relations
+	}
+	return relations
+}
+
+// containsExpression 检查条件是否已添加，避免重复执行同一语句时条件叠加
+func containsExpression(exprs []clause.Expression, expr clause.Eq) bool {
+	for _, e := range exprs {
+		if eq, ok := e.(clause.Eq); ok && eq == expr {
+			return true
+		}
+	}
+	return false
+}
+
+// stampTenant 为记录及其嵌套的关联记录设置租户ID和下级隔离列
+// visited记录已处理的结构体，防止循环引用
+func stampTenant(db *gorm.DB, s *schema.Schema, value reflect.Value, values []scopeValue, visited map[reflect.Value]bool) error {
+	if !value.IsValid() {
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return stampTenant(db, s, value.Elem(), values, visited)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := stampTenant(db, s, value.Index(i), values, visited); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if record, ok := value.Interface().(map[string]interface{}); ok {
+			for _, v := range values {
+				if field := s.FieldsByDBName[v.field]; field != nil {
+					record[field.DBName] = v.value
+				}
+			}
+		}
+	case reflect.Struct:
+		if value.Type() != s.ModelType || !value.CanAddr() || visited[value.Addr()] {
+			return nil
+		}
+		visited[value.Addr()] = true
+
+		ctx := db.Statement.Context
+		for _, v := range values {
+			if field := s.FieldsByDBName[v.field]; field != nil {
+				if err := field.Set(ctx, value, v.value); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, relation := range s.Relationships.Relations {
+			// 跳过GORM为反向引用生成的关联
+			if relation.Field.Schema.ModelType != s.ModelType {
+				continue
+			}
+			if err := stampTenant(db, relation.FieldSchema, relation.Field.ReflectValueOf(ctx, value), values, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
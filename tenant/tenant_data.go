@@ -0,0 +1,86 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// dataMoveKey 标记租户迁移、导出和导入语句的会话设置键，审计和配额插件不处理这些语句
+const dataMoveKey = "tenant:data_move"
+
+// isDataMove 检查语句是否来自租户迁移、导出或导入
+func isDataMove(db *gorm.DB) bool {
+	moving, ok := db.Get(dataMoveKey)
+	return ok && moving == true
+}
+
+// dataEndpoint 批量读写租户数据的共享库或独立库
+type dataEndpoint struct {
+	db *gorm.DB
+
+	// 共享库的租户ID字段，独立库为空
+	tenantField string
+}
+
+// newDataEndpoint 创建批量读写租户数据的连接，可重复使用
+func newDataEndpoint(db *gorm.DB, tenantField string) dataEndpoint {
+	return dataEndpoint{
+		db:          db.Set(dataMoveKey, true).Session(&gorm.Session{}),
+		tenantField: tenantField,
+	}
+}
+
+// dataEndpoint 获取跨租户访问的共享库，由调用方按租户ID过滤
+func (m *FieldDBManager) dataEndpoint(ctx context.Context, reason string) (dataEndpoint, error) {
+	db, err := m.GetDB(WithSystemScope(ctx, reason))
+	if err != nil {
+		return dataEndpoint{}, err
+	}
+	return newDataEndpoint(db, m.config.TenantIDField), nil
+}
+
+// dataEndpoint 获取租户的独立库
+func (m *TenantDBManager) dataEndpoint(ctx context.Context, tenantID string) (dataEndpoint, error) {
+	db, err := m.GetDBContext(ctx, tenantID)
+	if err != nil {
+		return dataEndpoint{}, err
+	}
+	return newDataEndpoint(db.WithContext(ctx), ""), nil
+}
+
+// scope 获取租户在表上的数据，包括软删除的记录
+func (e dataEndpoint) scope(s *schema.Schema, tenantID string) *gorm.DB {
+	db := UsePrimary(e.db.Unscoped().Model(reflect.New(s.ModelType).Interface()))
+	if e.tenantField != "" {
+		db = db.Where(clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: e.tenantField},
+			Value:  tenantID,
+		})
+	}
+	return db
+}
+
+// parseTenantModels 解析需要批量读写的模型，模型只能有一个主键
+// tenantField不为空时模型必须带有该字段
+func parseTenantModels(db *gorm.DB, models []interface{}, tenantField string) ([]*schema.Schema, error) {
+	schemas := make([]*schema.Schema, 0, len(models))
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+		if _, ok := stmt.Schema.FieldsByDBName[tenantField]; tenantField != "" && !ok {
+			return nil, fmt.Errorf("model %T has no tenant field %s", model, tenantField)
+		}
+		if len(stmt.Schema.PrimaryFields) != 1 {
+			return nil, fmt.Errorf("model %T must have exactly one primary key", model)
+		}
+		schemas = append(schemas, stmt.Schema)
+	}
+	return schemas, nil
+}
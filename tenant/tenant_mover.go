@@ -0,0 +1,520 @@
+package tenant
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrMoveInProgress 租户有未完成的反方向迁移
+	ErrMoveInProgress = errors.New("another move is in progress for tenant")
+
+	// ErrMoveChecksumMismatch 复制后目标库中的数据与源数据不一致
+	ErrMoveChecksumMismatch = errors.New("checksum mismatch between source and target rows")
+
+	// ErrMoveCountMismatch 复制完成后源库与目标库的行数不一致，通常是迁移期间仍有写入
+	ErrMoveCountMismatch = errors.New("row count mismatch between source and target")
+)
+
+// 迁移进度状态
+const (
+	// MoveStateCopying 正在复制数据
+	MoveStateCopying = "copying"
+	// MoveStateCopied 数据已复制并校验，尚未切换路由
+	MoveStateCopied = "copied"
+	// MoveStateSwitched 已切换路由，尚未删除源数据
+	MoveStateSwitched = "switched"
+	// MoveStateDone 迁移完成
+	MoveStateDone = "done"
+)
+
+// MoveProgress 租户迁移进度，保存在共享库中用于断点续传
+type MoveProgress struct {
+	TenantID string         `gorm:"primarykey;size:50"`
+	Target   IsolationLevel `gorm:"not null"`
+	State    string         `gorm:"size:16"`
+	// 各表的复制进度，键为表名
+	Tables    map[string]*TableMoveProgress `gorm:"serializer:json;type:text"`
+	UpdatedAt time.Time
+}
+
+// TableName 迁移进度表名
+func (MoveProgress) TableName() string {
+	return "tenant_move_progress"
+}
+
+// TableMoveProgress 单表的复制进度
+type TableMoveProgress struct {
+	// 最后复制的主键
+	LastKey string `json:"last_key"`
+	// 已复制的行数
+	Rows int64 `json:"rows"`
+	// 已复制数据的累计校验和
+	Checksum string `json:"checksum"`
+	// 是否复制完成
+	Done bool `json:"done"`
+}
+
+// source 源数据所在的隔离级别，与迁移目标相反
+func (p *MoveProgress) source() IsolationLevel {
+	if p.Target == IsolationField {
+		return IsolationDatabase
+	}
+	return IsolationField
+}
+
+// table 获取表的复制进度
+func (p *MoveProgress) table(name string) *TableMoveProgress {
+	if p.Tables == nil {
+		p.Tables = make(map[string]*TableMoveProgress)
+	}
+	if _, ok := p.Tables[name]; !ok {
+		p.Tables[name] = &TableMoveProgress{}
+	}
+	return p.Tables[name]
+}
+
+// MoverConfig 租户迁移配置
+type MoverConfig struct {
+	// 需要迁移的模型，必须带有租户ID字段且只有一个主键
+	// 按外键依赖顺序排列，删除源数据时按相反顺序
+	Models []interface{}
+
+	// 每批复制的行数
+	// 默认值: 500
+	BatchSize int
+}
+
+// NewDefaultMoverConfig 创建带有默认值的迁移配置
+func NewDefaultMoverConfig() *MoverConfig {
+	return &MoverConfig{
+		BatchSize: 500,
+	}
+}
+
+// MoveOptions 单次迁移选项
+type MoveOptions struct {
+	// 目标隔离级别，IsolationDatabase迁移到独立库，IsolationField迁移回共享库
+	Target IsolationLevel
+
+	// 迁移到独立库时的开通选项，仅首次执行时开通，Seed写入的数据会导致行数校验失败
+	// 默认值: nil (使用DSNTemplate)
+	Provision *ProvisionOptions
+
+	// 切换路由后是否删除源数据
+	// 默认值: false
+	PurgeSource bool
+
+	// 切换路由后执行的钩子，可用于持久化路由配置
+	SwitchHooks []TenantHook
+}
+
+// TenantMover 在共享库和独立库之间迁移租户数据
+// 按主键分批复制，每批写入后回读校验，进度保存在共享库中，失败后以相同参数重新调用Move即可续传
+// 迁移期间调用方需停止该租户的写入；迁移回共享库时主键需全局唯一，否则与其他租户冲突导致校验失败
+type TenantMover struct {
+	router *TenantRouter
+	config *MoverConfig
+}
+
+// NewTenantMover 创建租户迁移器
+func NewTenantMover(router *TenantRouter, config *MoverConfig) *TenantMover {
+	if config == nil {
+		config = NewDefaultMoverConfig()
+	} else if config.BatchSize <= 0 {
+		config.BatchSize = NewDefaultMoverConfig().BatchSize
+	}
+
+	return &TenantMover{
+		router: router,
+		config: config,
+	}
+}
+
+// Progress 获取租户的迁移进度，没有迁移记录时返回gorm.ErrRecordNotFound
+func (m *TenantMover) Progress(ctx context.Context, tenantID string) (*MoveProgress, error) {
+	shared, err := m.sharedDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var progress MoveProgress
+	if err := shared.db.First(&progress, "tenant_id = ?", tenantID).Error; err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+// Move 将租户迁移到目标隔离级别：复制并校验数据、切换路由，可选删除源数据
+func (m *TenantMover) Move(ctx context.Context, tenantID string, opts *MoveOptions) (*MoveProgress, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant ID cannot be empty")
+	}
+	if opts == nil {
+		opts = &MoveOptions{Target: IsolationDatabase}
+	}
+
+	shared, err := m.sharedDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := shared.db.AutoMigrate(&MoveProgress{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate move progress table: %w", err)
+	}
+
+	progress, resumed, err := m.loadProgress(shared.db, tenantID, opts.Target)
+	if err != nil {
+		return nil, err
+	}
+	if !resumed && m.router.Isolation(tenantID) == opts.Target {
+		return nil, fmt.Errorf("tenant %s already uses %s isolation", tenantID, opts.Target)
+	}
+
+	schemas, err := parseTenantModels(shared.db, m.config.Models, shared.tenantField)
+	if err != nil {
+		return nil, err
+	}
+
+	dedicated, err := m.dedicatedDB(ctx, tenantID, opts, resumed)
+	if err != nil {
+		return nil, err
+	}
+	source, target := shared, dedicated
+	if opts.Target == IsolationField {
+		source, target = target, source
+	}
+
+	if progress.State == MoveStateCopying {
+		for _, s := range schemas {
+			if progress.table(s.Table).Done {
+				continue
+			}
+			if err := m.copyTable(shared.db, progress, source, target, s); err != nil {
+				return progress, fmt.Errorf("failed to copy table %s for tenant %s: %w", s.Table, tenantID, err)
+			}
+		}
+		if err := verifyCounts(source, target, schemas, tenantID); err != nil {
+			return progress, err
+		}
+		if err := m.saveState(shared.db, progress, MoveStateCopied); err != nil {
+			return progress, err
+		}
+	}
+
+	// 路由只保存在内存中，从Switched续传时进程可能已重启，需要重新切换
+	if progress.State == MoveStateCopied || progress.State == MoveStateSwitched {
+		m.router.SetIsolation(tenantID, opts.Target)
+	}
+
+	if progress.State == MoveStateCopied {
+		if err := runHooks(ctx, tenantID, opts.SwitchHooks); err != nil {
+			return progress, fmt.Errorf("switch hook failed for tenant %s: %w", tenantID, err)
+		}
+		if err := m.saveState(shared.db, progress, MoveStateSwitched); err != nil {
+			return progress, err
+		}
+	}
+
+	if progress.State == MoveStateSwitched {
+		if opts.PurgeSource {
+			for i := len(schemas) - 1; i >= 0; i-- {
+				if err := m.purgeTable(source, schemas[i], tenantID); err != nil {
+					return progress, fmt.Errorf("failed to purge table %s for tenant %s: %w", schemas[i].Table, tenantID, err)
+				}
+			}
+		}
+		if err := m.saveState(shared.db, progress, MoveStateDone); err != nil {
+			return progress, err
+		}
+	}
+	return progress, nil
+}
+
+// RestoreRouting 根据已记录的迁移进度恢复路由，服务启动时调用
+// 已切换路由（Switched或Done）的租户按迁移目标设置隔离级别，
+// 尚未切换（Copying或Copied）的租户路由到源数据所在的一侧，返回恢复的租户数量
+func (m *TenantMover) RestoreRouting(ctx context.Context) (int, error) {
+	shared, err := m.sharedDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := shared.db.AutoMigrate(&MoveProgress{}); err != nil {
+		return 0, fmt.Errorf("failed to migrate move progress table: %w", err)
+	}
+
+	var progresses []MoveProgress
+	if err := shared.db.Find(&progresses).Error; err != nil {
+		return 0, fmt.Errorf("failed to load move progress: %w", err)
+	}
+	for _, progress := range progresses {
+		switch progress.State {
+		case MoveStateSwitched, MoveStateDone:
+			m.router.SetIsolation(progress.TenantID, progress.Target)
+		default:
+			// 迁移回共享库时，已完成迁移的记录被新的Copying记录替换，共享库中只有部分数据
+			m.router.SetIsolation(progress.TenantID, progress.source())
+		}
+	}
+	return len(progresses), nil
+}
+
+// sharedDB 获取跨租户访问的共享库
+func (m *TenantMover) sharedDB(ctx context.Context) (dataEndpoint, error) {
+	return m.router.shared.dataEndpoint(ctx, "tenant move")
+}
+
+// dedicatedDB 获取租户的独立库连接，首次迁移到独立库时先开通租户
+// 租户已注册独立库DSN时直接使用已开通的独立库
+func (m *TenantMover) dedicatedDB(ctx context.Context, tenantID string, opts *MoveOptions, resumed bool) (dataEndpoint, error) {
+	dedicated := m.router.dedicated
+
+	var db *gorm.DB
+	var err error
+	if opts.Target == IsolationDatabase && !resumed {
+		db, err = dedicated.ProvisionTenant(ctx, tenantID, opts.Provision)
+		if errors.Is(err, ErrTenantExists) {
+			db, err = dedicated.GetDBContext(ctx, tenantID)
+		}
+	} else {
+		// 续传时重新注册开通时指定的DSN
+		if opts.Target == IsolationDatabase && opts.Provision != nil && opts.Provision.DSN != "" {
+			dedicated.RegisterTenant(tenantID, opts.Provision.DSN)
+		}
+		db, err = dedicated.GetDBContext(ctx, tenantID)
+	}
+	if err != nil {
+		return dataEndpoint{}, err
+	}
+	return newDataEndpoint(db.WithContext(ctx), ""), nil
+}
+
+// loadProgress 加载未完成的迁移进度，没有时创建新的进度
+func (m *TenantMover) loadProgress(shared *gorm.DB, tenantID string, target IsolationLevel) (*MoveProgress, bool, error) {
+	var progress MoveProgress
+	err := shared.First(&progress, "tenant_id = ?", tenantID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, fmt.Errorf("failed to load move progress for tenant %s: %w", tenantID, err)
+	}
+
+	if err == nil && progress.State != MoveStateDone {
+		if progress.Target != target {
+			return nil, false, fmt.Errorf("%w: %s to %s", ErrMoveInProgress, tenantID, progress.Target)
+		}
+		return &progress, true, nil
+	}
+
+	return &MoveProgress{
+		TenantID: tenantID,
+		Target:   target,
+		State:    MoveStateCopying,
+		Tables:   make(map[string]*TableMoveProgress),
+	}, false, nil
+}
+
+// saveState 更新迁移状态并保存进度
+func (m *TenantMover) saveState(shared *gorm.DB, progress *MoveProgress, state string) error {
+	progress.State = state
+	return saveProgress(shared, progress)
+}
+
+// saveProgress 保存迁移进度
+func saveProgress(shared *gorm.DB, progress *MoveProgress) error {
+	if err := shared.Save(progress).Error; err != nil {
+		return fmt.Errorf("failed to save move progress for tenant %s: %w", progress.TenantID, err)
+	}
+	return nil
+}
+
+// copyTable 从上次的位置按主键分批复制表数据，每批写入后回读校验并保存进度
+func (m *TenantMover) copyTable(shared *gorm.DB, progress *MoveProgress, source, target dataEndpoint, s *schema.Schema) error {
+	ctx := shared.Statement.Context
+	table := progress.table(s.Table)
+	pk := s.PrimaryFields[0]
+	pkColumn := clause.Column{Table: clause.CurrentTable, Name: pk.DBName}
+	sliceType := reflect.SliceOf(s.ModelType)
+
+	for {
+		query := source.scope(s, progress.TenantID).Order(clause.OrderByColumn{Column: pkColumn}).Limit(m.config.BatchSize)
+		if table.LastKey != "" {
+			lastKey, err := parseKey(ctx, s, pk, table.LastKey)
+			if err != nil {
+				return err
+			}
+			query = query.Where(clause.Gt{Column: pkColumn, Value: lastKey})
+		}
+
+		records := reflect.New(sliceType)
+		if err := query.Find(records.Interface()).Error; err != nil {
+			return err
+		}
+		rows := records.Elem()
+		if rows.Len() == 0 {
+			break
+		}
+
+		// 迁移回共享库时设置租户ID
+		keys := make([]interface{}, rows.Len())
+		for i := 0; i < rows.Len(); i++ {
+			if target.tenantField != "" {
+				if err := s.FieldsByDBName[target.tenantField].Set(ctx, rows.Index(i), progress.TenantID); err != nil {
+					return err
+				}
+			}
+			keys[i], _ = pk.ValueOf(ctx, rows.Index(i))
+		}
+
+		checksum, err := checksumRecords(ctx, s, rows)
+		if err != nil {
+			return err
+		}
+
+		// 已存在的记录是上次中断前写入的，回读校验会发现不一致的数据
+		err = target.db.Session(&gorm.Session{SkipHooks: true}).
+			Omit(clause.Associations).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(records.Interface()).Error
+		if err != nil {
+			return err
+		}
+
+		copied := reflect.New(sliceType)
+		err = target.scope(s, progress.TenantID).
+			Where(clause.IN{Column: pkColumn, Values: keys}).
+			Order(clause.OrderByColumn{Column: pkColumn}).
+			Find(copied.Interface()).Error
+		if err != nil {
+			return err
+		}
+		copiedChecksum, err := checksumRecords(ctx, s, copied.Elem())
+		if err != nil {
+			return err
+		}
+		if copiedChecksum != checksum {
+			return fmt.Errorf("%w: keys %v to %v", ErrMoveChecksumMismatch, keys[0], keys[len(keys)-1])
+		}
+
+		table.LastKey = fmt.Sprint(keys[len(keys)-1])
+		table.Rows += int64(rows.Len())
+		table.Checksum = chainChecksum(table.Checksum, checksum)
+		if err := saveProgress(shared, progress); err != nil {
+			return err
+		}
+	}
+
+	table.Done = true
+	return saveProgress(shared, progress)
+}
+
+// purgeTable 按主键分批删除源库中租户的数据
+func (m *TenantMover) purgeTable(source dataEndpoint, s *schema.Schema, tenantID string) error {
+	pk := s.PrimaryFields[0]
+	pkColumn := clause.Column{Table: clause.CurrentTable, Name: pk.DBName}
+
+	for {
+		keys := reflect.New(reflect.SliceOf(pk.FieldType))
+		err := source.scope(s, tenantID).
+			Order(clause.OrderByColumn{Column: pkColumn}).
+			Limit(m.config.BatchSize).
+			Pluck(pk.DBName, keys.Interface()).Error
+		if err != nil {
+			return err
+		}
+		if keys.Elem().Len() == 0 {
+			return nil
+		}
+
+		values := make([]interface{}, keys.Elem().Len())
+		for i := range values {
+			values[i] = keys.Elem().Index(i).Interface()
+		}
+		err = source.scope(s, tenantID).
+			Where(clause.IN{Column: pkColumn, Values: values}).
+			Delete(reflect.New(s.ModelType).Interface()).Error
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// verifyCounts 校验源库与目标库中租户各表的行数
+func verifyCounts(source, target dataEndpoint, schemas []*schema.Schema, tenantID string) error {
+	for _, s := range schemas {
+		var sourceCount, targetCount int64
+		if err := source.scope(s, tenantID).Count(&sourceCount).Error; err != nil {
+			return err
+		}
+		if err := target.scope(s, tenantID).Count(&targetCount).Error; err != nil {
+			return err
+		}
+		if sourceCount != targetCount {
+			return fmt.Errorf("%w: table %s, source %d, target %d", ErrMoveCountMismatch, s.Table, sourceCount, targetCount)
+		}
+	}
+	return nil
+}
+
+// parseKey 将保存的主键字符串转换为主键字段的类型
+func parseKey(ctx context.Context, s *schema.Schema, pk *schema.Field, key string) (interface{}, error) {
+	record := reflect.New(s.ModelType).Elem()
+	if err := pk.Set(ctx, record, key); err != nil {
+		return nil, fmt.Errorf("failed to parse last key %s: %w", key, err)
+	}
+	value, _ := pk.ValueOf(ctx, record)
+	return value, nil
+}
+
+// checksumRecords 计算记录的校验和，时间统一为UTC以兼容不同的驱动
+func checksumRecords(ctx context.Context, s *schema.Schema, rows reflect.Value) (string, error) {
+	hash := sha256.New()
+	for i := 0; i < rows.Len(); i++ {
+		values := make([]interface{}, 0, len(s.DBNames))
+		for _, name := range s.DBNames {
+			value, _ := s.FieldsByDBName[name].ValueOf(ctx, rows.Index(i))
+			values = append(values, checksumValue(value))
+		}
+		data, err := json.Marshal(values)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode row for checksum: %w", err)
+		}
+		hash.Write(data)
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checksumValue 将字段值转换为与驱动无关的形式
+func checksumValue(value interface{}) interface{} {
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	if valuer, ok := value.(driver.Valuer); ok {
+		if v, err := valuer.Value(); err == nil {
+			value = v
+		}
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case *time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// chainChecksum 将一批数据的校验和累加到表的校验和
+func chainChecksum(previous, batch string) string {
+	sum := sha256.Sum256([]byte(previous + batch))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,304 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func newTestTenantMover(t *testing.T) (*TenantMover, *FieldDBManager, *TenantDBManager) {
+	t.Helper()
+	shared := newTestFieldDBManager(t)
+
+	config := NewDefaultDBConfig()
+	config.Dialect = SQLite
+	config.DSNTemplate = filepath.Join(t.TempDir(), "%s.db")
+	config.EnableTracing = false
+	config.MigrateFunc = func(db *gorm.DB) error {
+		return db.AutoMigrate(&testFieldUser{}, &testFieldOrder{})
+	}
+	dedicated := NewTenantDBManager(config)
+	t.Cleanup(dedicated.CloseAll)
+
+	mover := NewTenantMover(NewTenantRouter(shared, dedicated), &MoverConfig{
+		Models:    []interface{}{&testFieldUser{}, &testFieldOrder{}},
+		BatchSize: 2,
+	})
+	return mover, shared, dedicated
+}
+
+// seedMoveTenants 在共享库中为tenant-b写入2个用户，为tenant-a写入5个用户和1个订单
+func seedMoveTenants(t *testing.T, shared *FieldDBManager) {
+	t.Helper()
+	users := []testFieldUser{{Name: "b1", TenantID: "tenant-b"}, {Name: "b2", TenantID: "tenant-b"}}
+	for i := 1; i <= 5; i++ {
+		users = append(users, testFieldUser{Name: fmt.Sprintf("a%d", i), TenantID: "tenant-a"})
+	}
+	if err := shared.db.Create(&users).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := shared.db.Create(&testFieldOrder{Item: "book", TenantID: "tenant-a"}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+}
+
+// countUsers 统计租户在路由到的数据库中的用户数
+func countUsers(t *testing.T, router *TenantRouter, tenantID string) int64 {
+	t.Helper()
+	db, err := router.GetDB(WithTenant(context.Background(), tenantID))
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	var count int64
+	if err := db.Model(&testFieldUser{}).Count(&count).Error; err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	return count
+}
+
+func TestTenantMover_Move(t *testing.T) {
+	mover, shared, _ := newTestTenantMover(t)
+	seedMoveTenants(t, shared)
+
+	var switched []string
+	progress, err := mover.Move(context.Background(), "tenant-a", &MoveOptions{
+		Target:      IsolationDatabase,
+		PurgeSource: true,
+		SwitchHooks: []TenantHook{func(ctx context.Context, tenantID string) error {
+			switched = append(switched, tenantID)
+			return nil
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if progress.State != MoveStateDone || progress.Tables["test_field_users"].Rows != 5 {
+		t.Errorf("Move() progress = %v/%v, want %v/%v", progress.State, progress.Tables["test_field_users"].Rows, MoveStateDone, 5)
+	}
+	if len(switched) != 1 {
+		t.Errorf("SwitchHooks called %v times, want %v", len(switched), 1)
+	}
+
+	if got := mover.router.Isolation("tenant-a"); got != IsolationDatabase {
+		t.Errorf("Isolation() = %v, want %v", got, IsolationDatabase)
+	}
+	if got := countUsers(t, mover.router, "tenant-a"); got != 5 {
+		t.Errorf("dedicated tenant-a users = %v, want %v", got, 5)
+	}
+	if got := countUsers(t, mover.router, "tenant-b"); got != 2 {
+		t.Errorf("shared tenant-b users = %v, want %v", got, 2)
+	}
+	var remaining int64
+	if err := shared.db.Model(&testFieldUser{}).Where("tenant_id = ?", "tenant-a").Count(&remaining).Error; err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if remaining != 0 {
+		t.Errorf("shared tenant-a users after purge = %v, want %v", remaining, 0)
+	}
+
+	if _, err := mover.Move(context.Background(), "tenant-a", &MoveOptions{Target: IsolationDatabase}); err == nil {
+		t.Errorf("Move() to current isolation error = nil, want error")
+	}
+
+	// 迁移回共享库，保留独立库中的数据
+	progress, err = mover.Move(context.Background(), "tenant-a", &MoveOptions{Target: IsolationField})
+	if err != nil {
+		t.Fatalf("Move() back error = %v", err)
+	}
+	if progress.State != MoveStateDone {
+		t.Errorf("Move() back state = %v, want %v", progress.State, MoveStateDone)
+	}
+	if got := mover.router.Isolation("tenant-a"); got != IsolationField {
+		t.Errorf("Isolation() = %v, want %v", got, IsolationField)
+	}
+	if got := countUsers(t, mover.router, "tenant-a"); got != 5 {
+		t.Errorf("shared tenant-a users = %v, want %v", got, 5)
+	}
+}
+
+func TestTenantMover_Resume(t *testing.T) {
+	mover, shared, dedicated := newTestTenantMover(t)
+	seedMoveTenants(t, shared)
+
+	db, err := dedicated.ProvisionTenant(context.Background(), "tenant-a", nil)
+	if err != nil {
+		t.Fatalf("ProvisionTenant() error = %v", err)
+	}
+
+	// 第二批写入时中断
+	batches := 0
+	interrupted := errors.New("interrupted")
+	err = db.Callback().Create().Before("gorm:create").Register("test:interrupt", func(db *gorm.DB) {
+		if db.Statement.Table == "test_field_users" {
+			if batches++; batches == 2 {
+				_ = db.AddError(interrupted)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	if _, err := mover.Move(context.Background(), "tenant-a", nil); !errors.Is(err, interrupted) {
+		t.Fatalf("Move() error = %v, want %v", err, interrupted)
+	}
+	progress, err := mover.Progress(context.Background(), "tenant-a")
+	if err != nil {
+		t.Fatalf("Progress() error = %v", err)
+	}
+	if progress.State != MoveStateCopying || progress.Tables["test_field_users"].Rows != 2 {
+		t.Errorf("Progress() = %v/%v, want %v/%v", progress.State, progress.Tables["test_field_users"].Rows, MoveStateCopying, 2)
+	}
+	if got := mover.router.Isolation("tenant-a"); got != IsolationField {
+		t.Errorf("Isolation() after failure = %v, want %v", got, IsolationField)
+	}
+
+	if _, err := mover.Move(context.Background(), "tenant-a", &MoveOptions{Target: IsolationField}); !errors.Is(err, ErrMoveInProgress) {
+		t.Errorf("Move() opposite direction error = %v, want %v", err, ErrMoveInProgress)
+	}
+
+	progress, err = mover.Move(context.Background(), "tenant-a", nil)
+	if err != nil {
+		t.Fatalf("Move() resume error = %v", err)
+	}
+	if progress.State != MoveStateDone || progress.Tables["test_field_users"].Rows != 5 {
+		t.Errorf("Move() resume = %v/%v, want %v/%v", progress.State, progress.Tables["test_field_users"].Rows, MoveStateDone, 5)
+	}
+	if batches != 4 {
+		t.Errorf("user batches = %v, want %v", batches, 4)
+	}
+	if got := countUsers(t, mover.router, "tenant-a"); got != 5 {
+		t.Errorf("dedicated tenant-a users = %v, want %v", got, 5)
+	}
+}
+
+func TestTenantMover_ResumeSwitched(t *testing.T) {
+	mover, shared, dedicated := newTestTenantMover(t)
+	seedMoveTenants(t, shared)
+
+	// 切换路由后删除源数据时中断
+	interrupted := errors.New("interrupted")
+	failPurge := true
+	err := shared.db.Callback().Delete().Before("gorm:delete").Register("test:interrupt", func(db *gorm.DB) {
+		if failPurge {
+			_ = db.AddError(interrupted)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	options := &MoveOptions{Target: IsolationDatabase, PurgeSource: true}
+	if _, err := mover.Move(context.Background(), "tenant-a", options); !errors.Is(err, interrupted) {
+		t.Fatalf("Move() error = %v, want %v", err, interrupted)
+	}
+	progress, err := mover.Progress(context.Background(), "tenant-a")
+	if err != nil {
+		t.Fatalf("Progress() error = %v", err)
+	}
+	if progress.State != MoveStateSwitched {
+		t.Fatalf("Progress() state = %v, want %v", progress.State, MoveStateSwitched)
+	}
+
+	// 模拟进程重启，内存中的路由丢失
+	restarted := NewTenantMover(NewTenantRouter(shared, dedicated), mover.config)
+	if got := restarted.router.Isolation("tenant-a"); got != IsolationField {
+		t.Fatalf("Isolation() after restart = %v, want %v", got, IsolationField)
+	}
+	restored := NewTenantMover(NewTenantRouter(shared, dedicated), mover.config)
+	if n, err := restored.RestoreRouting(context.Background()); err != nil || n != 1 {
+		t.Errorf("RestoreRouting() = %v, %v, want %v", n, err, 1)
+	}
+	if got := restored.router.Isolation("tenant-a"); got != IsolationDatabase {
+		t.Errorf("Isolation() after RestoreRouting = %v, want %v", got, IsolationDatabase)
+	}
+
+	failPurge = false
+	progress, err = restarted.Move(context.Background(), "tenant-a", options)
+	if err != nil {
+		t.Fatalf("Move() resume error = %v", err)
+	}
+	if progress.State != MoveStateDone {
+		t.Errorf("Move() resume state = %v, want %v", progress.State, MoveStateDone)
+	}
+	if got := restarted.router.Isolation("tenant-a"); got != IsolationDatabase {
+		t.Errorf("Isolation() after resume = %v, want %v", got, IsolationDatabase)
+	}
+	if got := countUsers(t, restarted.router, "tenant-a"); got != 5 {
+		t.Errorf("dedicated tenant-a users = %v, want %v", got, 5)
+	}
+}
+
+func TestTenantMover_RestartDuringReverseMove(t *testing.T) {
+	mover, shared, dedicated := newTestTenantMover(t)
+	seedMoveTenants(t, shared)
+
+	ctx := context.Background()
+	if _, err := mover.Move(ctx, "tenant-a", &MoveOptions{Target: IsolationDatabase, PurgeSource: true}); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	// 迁移回共享库时在第二批写入时中断
+	batches := 0
+	interrupted := errors.New("interrupted")
+	err := shared.db.Callback().Create().Before("gorm:create").Register("test:interrupt", func(db *gorm.DB) {
+		if db.Statement.Table == "test_field_users" {
+			if batches++; batches == 2 {
+				_ = db.AddError(interrupted)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if _, err := mover.Move(ctx, "tenant-a", &MoveOptions{Target: IsolationField}); !errors.Is(err, interrupted) {
+		t.Fatalf("Move() back error = %v, want %v", err, interrupted)
+	}
+	progress, err := mover.Progress(ctx, "tenant-a")
+	if err != nil {
+		t.Fatalf("Progress() error = %v", err)
+	}
+	if progress.State != MoveStateCopying || progress.Target != IsolationField {
+		t.Fatalf("Progress() = %v/%v, want %v/%v", progress.State, progress.Target, MoveStateCopying, IsolationField)
+	}
+
+	// 模拟进程重启，共享库中只有部分数据，路由应保持在独立库
+	restarted := NewTenantMover(NewTenantRouter(shared, dedicated), mover.config)
+	if n, err := restarted.RestoreRouting(ctx); err != nil || n != 1 {
+		t.Errorf("RestoreRouting() = %v, %v, want %v", n, err, 1)
+	}
+	if got := restarted.router.Isolation("tenant-a"); got != IsolationDatabase {
+		t.Errorf("Isolation() after RestoreRouting = %v, want %v", got, IsolationDatabase)
+	}
+	if got := countUsers(t, restarted.router, "tenant-a"); got != 5 {
+		t.Errorf("tenant-a users after restart = %v, want %v", got, 5)
+	}
+}
+
+func TestTenantMover_ChecksumMismatch(t *testing.T) {
+	mover, shared, dedicated := newTestTenantMover(t)
+	seedMoveTenants(t, shared)
+
+	db, err := dedicated.ProvisionTenant(context.Background(), "tenant-a", nil)
+	if err != nil {
+		t.Fatalf("ProvisionTenant() error = %v", err)
+	}
+	// 独立库中已有主键相同但内容不同的记录
+	var first testFieldUser
+	if err := shared.db.Where("tenant_id = ?", "tenant-a").Order("id").First(&first).Error; err != nil {
+		t.Fatalf("First() error = %v", err)
+	}
+	if err := db.Create(&testFieldUser{ID: first.ID, Name: "stale", TenantID: "tenant-a"}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if _, err := mover.Move(context.Background(), "tenant-a", nil); !errors.Is(err, ErrMoveChecksumMismatch) {
+		t.Errorf("Move() error = %v, want %v", err, ErrMoveChecksumMismatch)
+	}
+	if got := mover.router.Isolation("tenant-a"); got != IsolationField {
+		t.Errorf("Isolation() = %v, want %v", got, IsolationField)
+	}
+}
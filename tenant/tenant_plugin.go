@@ -0,0 +1,344 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrTenantFieldChanged 更新操作试图修改租户ID或下级隔离列
+	ErrTenantFieldChanged = errors.New("tenant field cannot be changed")
+
+	// ErrRawSQLNotAllowed 租户会话上执行了未显式放行的原生SQL
+	ErrRawSQLNotAllowed = errors.New("raw SQL is not allowed on tenant session, use AllowRawSQL to opt out")
+
+	// ErrUpsertNotAllowed 当前方言无法将冲突更新限制在当前租户内
+	ErrUpsertNotAllowed = errors.New("upsert with updates is not supported on tenant session for this dialect")
+)
+
+// allowRawSQLKey 放行原生SQL的会话设置键
+const allowRawSQLKey = "tenant:allow_raw_sql"
+
+// TenantPlugin 字段级租户隔离GORM插件
+// 在共享连接上注册一次，每次执行时从语句上下文读取租户ID和下级隔离列的值
+// 上下文中没有租户ID或带有WithSystemScope的语句不做处理
+type TenantPlugin struct {
+	// 租户ID字段名
+	TenantIDField string
+
+	// 租户内的下级隔离列，按层级从上到下排列
+	Scopes []ScopeColumn
+
+	// 判断调用方是否可以通过WidenToTenant放宽到租户级别
+	// 为nil时不允许放宽
+	WidenPermission func(ctx context.Context) bool
+
+	// 拒绝无法添加租户条件的字符串连接，如Joins("JOIN orders ON ...")
+	// 为false时这类连接不添加租户条件，调用方需在ON条件中自行过滤
+	StrictJoins bool
+}
+
+// NewTenantPlugin 创建字段级租户隔离插件
+func NewTenantPlugin(tenantIDField string, scopes ...ScopeColumn) *TenantPlugin {
+	return &TenantPlugin{TenantIDField: tenantIDField, Scopes: scopes}
+}
+
+// Name 实现gorm.Plugin接口
+func (p *TenantPlugin) Name() string {
+	return "tenant"
+}
+
+// Initialize 实现gorm.Plugin接口，注册租户回调
+func (p *TenantPlugin) Initialize(db *gorm.DB) error {
+	callbacks := []error{
+		db.Callback().Query().Before("gorm:query").Register("tenant:query", p.queryCallback),
+		db.Callback().Row().Before("gorm:row").Register("tenant:row", p.queryCallback),
+		db.Callback().Create().Before("gorm:create").Register("tenant:create", p.createCallback),
+		db.Callback().Update().After("gorm:before_update").Before("gorm:update").Register("tenant:update", p.updateCallback),
+		db.Callback().Delete().Before("gorm:delete").Register("tenant:delete", p.deleteCallback),
+		db.Callback().Raw().Before("gorm:raw").Register("tenant:raw", p.rawCallback),
+	}
+	for _, err := range callbacks {
+		if err != nil {
+			return fmt.Errorf("failed to register tenant callback: %w", err)
+		}
+	}
+	return nil
+}
+
+// scopeValues 从上下文中获取生效的租户ID和下级隔离列的值
+// 跨租户访问或没有租户ID时返回空，缺少值的下级隔离列不做处理
+func (p *TenantPlugin) scopeValues(ctx context.Context) ([]scopeValue, error) {
+	if _, ok := GetSystemScope(ctx); ok {
+		return nil, nil
+	}
+	tenantID, ok := GetTenantFromContext(ctx)
+	if !ok || tenantID == "" {
+		return nil, nil
+	}
+
+	values := []scopeValue{{field: p.TenantIDField, value: tenantID}}
+	if isWidened(ctx) {
+		if p.WidenPermission == nil || !p.WidenPermission(ctx) {
+			return nil, ErrScopeWidenDenied
+		}
+		return values, nil
+	}
+
+	for _, scope := range p.Scopes {
+		if value, ok := scope.resolve(ctx); ok {
+			values = append(values, scopeValue{field: scope.Field, value: value})
+		}
+	}
+	return values, nil
+}
+
+// resolve 获取语句生效的隔离列，没有需要处理的隔离列时返回false
+func (p *TenantPlugin) resolve(db *gorm.DB) ([]scopeValue, bool) {
+	if db.Error != nil || db.Statement.Context == nil {
+		return nil, false
+	}
+
+	values, err := p.scopeValues(db.Statement.Context)
+	if err != nil {
+		_ = db.AddError(err)
+		return nil, false
+	}
+	return values, len(values) > 0
+}
+
+// scopedField 模型上的隔离字段及其值
+type scopedField struct {
+	field *schema.Field
+	value string
+}
+
+// scopedFields 获取模型上存在的隔离字段
+func scopedFields(db *gorm.DB, values []scopeValue) []scopedField {
+	var fields []scopedField
+	for _, v := range values {
+		if field := tenantField(db, v.field); field != nil {
+			fields = append(fields, scopedField{field: field, value: v.value})
+		}
+	}
+	return fields
+}
+
+// AllowRawSQL 允许在租户会话上执行原生SQL
+// 原生SQL不会自动添加租户条件，调用方需自行保证只访问当前租户的数据
+func AllowRawSQL(db *gorm.DB) *gorm.DB {
+	return db.Set(allowRawSQLKey, true)
+}
+
+// rawSQLAllowed 检查当前会话是否放行原生SQL
+func rawSQLAllowed(db *gorm.DB) bool {
+	allowed, ok := db.Get(allowRawSQLKey)
+	return ok && allowed == true
+}
+
+// tenantField 获取模型的租户ID字段，模型没有该字段时返回nil
+func tenantField(db *gorm.DB, fieldName string) *schema.Field {
+	if db.Statement.Schema == nil {
+		return nil
+	}
+	return db.Statement.Schema.FieldsByDBName[fieldName]
+}
+
+// addTenantCondition 为语句添加租户过滤条件
+func addTenantCondition(db *gorm.DB, field *schema.Field, tenantID string) {
+	db.Statement.AddClause(clause.Where{
+		Exprs: []clause.Expression{
+			clause.Eq{
+				Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName},
+				Value:  tenantID,
+			},
+		},
+	})
+}
+
+// hasWhereConditions 检查语句是否带有过滤条件或主键
+// 用于在添加租户条件之前保留GORM对无条件更新和删除的保护
+func hasWhereConditions(db *gorm.DB) bool {
+	if db.AllowGlobalUpdate {
+		return true
+	}
+
+	if c, ok := db.Statement.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			return true
+		}
+	}
+
+	if hasPrimaryValues(db, db.Statement.ReflectValue) {
+		return true
+	}
+	return db.Statement.Model != nil && hasPrimaryValues(db, reflect.ValueOf(db.Statement.Model))
+}
+
+// hasPrimaryValues 检查值中是否包含非零主键
+func hasPrimaryValues(db *gorm.DB, value reflect.Value) bool {
+	if db.Statement.Schema == nil || !value.IsValid() {
+		return false
+	}
+
+	value = reflect.Indirect(value)
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type() != db.Statement.Schema.ModelType {
+			return false
+		}
+		for _, field := range db.Statement.Schema.PrimaryFields {
+			if _, isZero := field.ValueOf(db.Statement.Context, value); !isZero {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if hasPrimaryValues(db, value.Index(i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queryCallback 为查询添加租户过滤条件，拒绝未放行的原生SQL
+func (p *TenantPlugin) queryCallback(db *gorm.DB) {
+	values, ok := p.resolve(db)
+	if !ok {
+		return
+	}
+
+	if db.Statement.SQL.Len() > 0 {
+		if !rawSQLAllowed(db) {
+			_ = db.AddError(ErrRawSQLNotAllowed)
+		}
+		return
+	}
+
+	for _, f := range scopedFields(db, values) {
+		addTenantCondition(db, f.field, f.value)
+	}
+	_ = db.AddError(scopeJoins(db, values, p.StrictJoins && !rawSQLAllowed(db)))
+}
+
+// createCallback 创建记录时自动设置租户ID，包括批量创建和嵌套的关联记录
+func (p *TenantPlugin) createCallback(db *gorm.DB) {
+	values, ok := p.resolve(db)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+
+	if err := stampTenant(db, db.Statement.Schema, db.Statement.ReflectValue, values, map[reflect.Value]bool{}); err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	_ = db.AddError(restrictUpsert(db, scopedFields(db, values)))
+}
+
+// updateCallback 为更新添加租户过滤条件，并拒绝修改租户ID和下级隔离列
+func (p *TenantPlugin) updateCallback(db *gorm.DB) {
+	values, ok := p.resolve(db)
+	if !ok {
+		return
+	}
+
+	fields := scopedFields(db, values)
+	if len(fields) == 0 {
+		return
+	}
+
+	for _, f := range fields {
+		if err := checkTenantAssignments(db, f.field, f.value); err != nil {
+			_ = db.AddError(err)
+			return
+		}
+	}
+
+	if !hasWhereConditions(db) {
+		_ = db.AddError(gorm.ErrMissingWhereClause)
+		return
+	}
+	for _, f := range fields {
+		addTenantCondition(db, f.field, f.value)
+	}
+}
+
+// deleteCallback 为删除添加租户过滤条件
+func (p *TenantPlugin) deleteCallback(db *gorm.DB) {
+	values, ok := p.resolve(db)
+	if !ok {
+		return
+	}
+
+	fields := scopedFields(db, values)
+	if len(fields) == 0 {
+		return
+	}
+
+	if !hasWhereConditions(db) {
+		_ = db.AddError(gorm.ErrMissingWhereClause)
+		return
+	}
+	for _, f := range fields {
+		addTenantCondition(db, f.field, f.value)
+	}
+}
+
+// rawCallback 拒绝租户会话上未放行的原生SQL
+func (p *TenantPlugin) rawCallback(db *gorm.DB) {
+	if _, ok := p.resolve(db); ok && !rawSQLAllowed(db) {
+		_ = db.AddError(ErrRawSQLNotAllowed)
+	}
+}
+
+// checkTenantAssignments 检查更新内容中的租户ID字段
+// 值与当前租户不同时返回错误，结构体中租户ID为空时设置为当前租户，避免Save清空租户ID
+func checkTenantAssignments(db *gorm.DB, field *schema.Field, tenantID string) error {
+	if c, ok := db.Statement.Clauses["SET"]; ok {
+		if set, ok := c.Expression.(clause.Set); ok {
+			for _, assignment := range set {
+				if assignment.Column.Name == field.DBName && !sameTenant(assignment.Value, tenantID) {
+					return fmt.Errorf("%w: %v", ErrTenantFieldChanged, assignment.Value)
+				}
+			}
+		}
+	}
+
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		for key, value := range dest {
+			if (key == field.DBName || key == field.Name) && !sameTenant(value, tenantID) {
+				return fmt.Errorf("%w: %v", ErrTenantFieldChanged, value)
+			}
+		}
+	default:
+		value := reflect.Indirect(reflect.ValueOf(dest))
+		if value.Kind() != reflect.Struct || value.Type() != field.Schema.ModelType {
+			return nil
+		}
+
+		current, isZero := field.ValueOf(db.Statement.Context, value)
+		if isZero {
+			if value.CanAddr() {
+				return field.Set(db.Statement.Context, value, tenantID)
+			}
+			return nil
+		}
+		if !sameTenant(current, tenantID) {
+			return fmt.Errorf("%w: %v", ErrTenantFieldChanged, current)
+		}
+	}
+	return nil
+}
+
+// sameTenant 比较字段值与租户ID，兼容非字符串类型的租户ID字段
+func sameTenant(value interface{}, tenantID string) bool {
+	return fmt.Sprint(value) == tenantID
+}
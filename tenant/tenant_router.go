@@ -0,0 +1,88 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// IsolationLevel 租户的隔离级别
+type IsolationLevel int
+
+const (
+	// IsolationField 字段级隔离，数据存放在共享库中
+	IsolationField IsolationLevel = iota
+	// IsolationDatabase 数据库级隔离，数据存放在租户独立库中
+	IsolationDatabase
+)
+
+// String 隔离级别名称
+func (l IsolationLevel) String() string {
+	switch l {
+	case IsolationField:
+		return "field"
+	case IsolationDatabase:
+		return "database"
+	}
+	return fmt.Sprintf("IsolationLevel(%d)", l)
+}
+
+// TenantRouter 按租户的隔离级别路由到共享库或独立库
+// 未设置隔离级别的租户使用共享库
+type TenantRouter struct {
+	shared    *FieldDBManager
+	dedicated *TenantDBManager
+	mutex     sync.RWMutex
+	levels    map[string]IsolationLevel
+}
+
+// NewTenantRouter 创建租户路由，dedicatedTenants为使用独立库的租户
+func NewTenantRouter(shared *FieldDBManager, dedicated *TenantDBManager, dedicatedTenants ...string) *TenantRouter {
+	levels := make(map[string]IsolationLevel, len(dedicatedTenants))
+	for _, tenantID := range dedicatedTenants {
+		levels[tenantID] = IsolationDatabase
+	}
+
+	return &TenantRouter{
+		shared:    shared,
+		dedicated: dedicated,
+		levels:    levels,
+	}
+}
+
+// Isolation 获取租户的隔离级别
+func (r *TenantRouter) Isolation(tenantID string) IsolationLevel {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.levels[tenantID]
+}
+
+// SetIsolation 设置租户的隔离级别，之后的GetDB调用路由到对应的数据库
+func (r *TenantRouter) SetIsolation(tenantID string, level IsolationLevel) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if level == IsolationField {
+		delete(r.levels, tenantID)
+		return
+	}
+	r.levels[tenantID] = level
+}
+
+// GetDB 获取上下文中租户的数据库连接
+// 使用独立库的租户返回其租户库，其他情况返回共享库，规则与FieldDBManager.GetDB相同
+func (r *TenantRouter) GetDB(ctx context.Context) (*gorm.DB, error) {
+	if _, ok := GetSystemScope(ctx); !ok {
+		if tenantID, ok := GetTenantFromContext(ctx); ok && r.Isolation(tenantID) == IsolationDatabase {
+			db, err := r.dedicated.GetDBContext(ctx, tenantID)
+			if err != nil {
+				return nil, err
+			}
+			return db.WithContext(ctx), nil
+		}
+	}
+	return r.shared.GetDB(ctx)
+}
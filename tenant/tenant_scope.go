@@ -0,0 +1,70 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrMissingScope 严格模式下上下文中缺少下级隔离列的值
+	ErrMissingScope = errors.New("scope value missing from context, use WithScope or WidenToTenant")
+
+	// ErrScopeWidenDenied 调用方没有放宽到租户级别的权限
+	ErrScopeWidenDenied = errors.New("widening to tenant scope is not permitted")
+)
+
+// ScopeColumn 租户内的下级隔离列，例如组织或门店
+type ScopeColumn struct {
+	// 列名，例如 "org_id"
+	Field string
+
+	// 从上下文获取该列的值
+	// 默认值: nil (使用WithScope写入的值)
+	Resolve func(ctx context.Context) (string, bool)
+}
+
+// resolve 从上下文获取隔离列的值
+func (c ScopeColumn) resolve(ctx context.Context) (string, bool) {
+	if c.Resolve != nil {
+		value, ok := c.Resolve(ctx)
+		return value, ok && value != ""
+	}
+	return GetScopeFromContext(ctx, c.Field)
+}
+
+// scopeContextKey 下级隔离列的上下文键
+type scopeContextKey struct {
+	field string
+}
+
+// WithScope 创建包含下级隔离列值的上下文
+func WithScope(ctx context.Context, field, value string) context.Context {
+	return context.WithValue(ctx, scopeContextKey{field: field}, value)
+}
+
+// GetScopeFromContext 从上下文中获取下级隔离列的值
+func GetScopeFromContext(ctx context.Context, field string) (string, bool) {
+	value, ok := ctx.Value(scopeContextKey{field: field}).(string)
+	return value, ok && value != ""
+}
+
+// widenScopeKey 放宽到租户级别的上下文键
+type widenScopeKey struct{}
+
+// WidenToTenant 创建只按租户隔离的上下文，忽略所有下级隔离列
+// 需要FieldDBConfig.WidenPermission允许，否则返回ErrScopeWidenDenied
+func WidenToTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, widenScopeKey{}, true)
+}
+
+// isWidened 检查上下文是否放宽到租户级别
+func isWidened(ctx context.Context) bool {
+	widened, _ := ctx.Value(widenScopeKey{}).(bool)
+	return widened
+}
+
+// scopeValue 语句生效的隔离列及其值
+type scopeValue struct {
+	field string
+	value string
+}
@@ -0,0 +1,288 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/hashicorp/consul/api"
+	"github.com/onebids/onecommon/kvconfig"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrEmptyTenantSnapshot 租户来源返回了空的租户列表，且没有设置AllowEmptyTenantSync
+var ErrEmptyTenantSnapshot = errors.New("tenant source returned no tenants")
+
+// WatchableTenantSource 支持监听变更的租户来源
+type WatchableTenantSource interface {
+	TenantSource
+
+	// Watch 监听租户变更，每次变更时以全量租户调用onChange，直到ctx取消
+	Watch(ctx context.Context, onChange func(tenants map[string]string)) error
+}
+
+// ConsulTenantSource 基于Consul KV的租户来源
+// 每个租户对应前缀下的一个键，键名最后一段为租户ID，值为DSN，例如:
+//
+//	onebids/tenants/tenant1 = user:pass@tcp(host:3306)/tenant1?charset=utf8mb4
+type ConsulTenantSource struct {
+	client *api.Client
+	prefix string
+
+	// 阻塞查询的最长等待时间
+	WaitTime time.Duration
+
+	// 查询失败后的重试间隔
+	RetryInterval time.Duration
+}
+
+// NewConsulTenantSource 创建基于Consul KV的租户来源
+func NewConsulTenantSource(registryAddr, prefix string) (*ConsulTenantSource, error) {
+	client, err := kvconfig.NewConsulClient(registryAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Consul client: %w", err)
+	}
+
+	return &ConsulTenantSource{
+		client:        client,
+		prefix:        strings.TrimSuffix(prefix, "/") + "/",
+		WaitTime:      5 * time.Minute,
+		RetryInterval: 5 * time.Second,
+	}, nil
+}
+
+// LoadTenants 加载所有租户
+func (s *ConsulTenantSource) LoadTenants(ctx context.Context) (map[string]string, error) {
+	pairs, _, err := s.client.KV().List(s.prefix, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants under %s: %w", s.prefix, err)
+	}
+	return s.parse(pairs), nil
+}
+
+// Watch 使用Consul阻塞查询监听前缀下的变更
+func (s *ConsulTenantSource) Watch(ctx context.Context, onChange func(tenants map[string]string)) error {
+	var lastIndex uint64
+	for {
+		opts := (&api.QueryOptions{WaitIndex: lastIndex, WaitTime: s.WaitTime}).WithContext(ctx)
+		pairs, meta, err := s.client.KV().List(s.prefix, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			klog.CtxWarnf(ctx, "watch tenants under %s failed: %v", s.prefix, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.RetryInterval):
+			}
+			continue
+		}
+
+		// 索引回退时重新开始监听
+		if meta.LastIndex < lastIndex {
+			lastIndex = 0
+			continue
+		}
+		if meta.LastIndex == lastIndex {
+			continue
+		}
+
+		lastIndex = meta.LastIndex
+		onChange(s.parse(pairs))
+	}
+}
+
+// parse 将KV列表转换为租户DSN映射
+func (s *ConsulTenantSource) parse(pairs api.KVPairs) map[string]string {
+	tenants := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		tenantID := strings.TrimPrefix(pair.Key, s.prefix)
+		dsn := strings.TrimSpace(string(pair.Value))
+		// 跳过目录键和嵌套键
+		if tenantID == "" || strings.Contains(tenantID, "/") || dsn == "" {
+			continue
+		}
+		tenants[tenantID] = dsn
+	}
+	return tenants
+}
+
+// FileTenantSource 基于本地文件的租户来源，用于本地开发
+// 文件为YAML格式的租户ID到DSN的映射，例如:
+//
+//	tenant1: user:pass@tcp(localhost:3306)/tenant1?charset=utf8mb4
+//	tenant2: user:pass@tcp(localhost:3306)/tenant2?charset=utf8mb4
+type FileTenantSource struct {
+	path string
+
+	// 检查文件变更的间隔
+	PollInterval time.Duration
+}
+
+// NewFileTenantSource 创建基于本地文件的租户来源
+func NewFileTenantSource(path string) *FileTenantSource {
+	return &FileTenantSource{
+		path:         path,
+		PollInterval: 2 * time.Second,
+	}
+}
+
+// LoadTenants 加载所有租户
+func (s *FileTenantSource) LoadTenants(ctx context.Context) (map[string]string, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenant file %s: %w", s.path, err)
+	}
+
+	tenants := make(map[string]string)
+	if err := yaml.Unmarshal(content, &tenants); err != nil {
+		return nil, fmt.Errorf("failed to parse tenant file %s: %w", s.path, err)
+	}
+	return tenants, nil
+}
+
+// Watch 定期检查文件修改时间，文件变化时重新加载
+func (s *FileTenantSource) Watch(ctx context.Context, onChange func(tenants map[string]string)) error {
+	var lastModified time.Time
+	if info, err := os.Stat(s.path); err == nil {
+		lastModified = info.ModTime()
+	}
+
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(s.path)
+		if err != nil || !info.ModTime().After(lastModified) {
+			continue
+		}
+
+		tenants, err := s.LoadTenants(ctx)
+		if err != nil {
+			// 文件可能正在写入，下次检查时重试
+			klog.CtxWarnf(ctx, "reload tenant file failed: %v", err)
+			continue
+		}
+		lastModified = info.ModTime()
+		onChange(tenants)
+	}
+}
+
+// TenantSyncResult 租户同步结果
+type TenantSyncResult struct {
+	Added   []string
+	Updated []string
+	Removed []string
+}
+
+// SyncTenants 以tenants为准同步租户配置，不影响默认库
+// 新租户注册DSN；DSN变化的租户关闭连接池，下次GetDB时使用新DSN重新连接；
+// 之前由SyncTenants添加、不在tenants中的租户被移除，关闭连接池并阻止后续访问，
+// 直到重新出现在tenants中或重新RegisterTenant；静态配置、RegisterTenant注册和通过DSNTemplate访问的租户不会被移除
+// tenants为空时返回ErrEmptyTenantSnapshot，除非设置了AllowEmptyTenantSync
+// 同步期间正在创建的旧连接池不会被存入缓存
+func (m *TenantDBManager) SyncTenants(tenants map[string]string) (TenantSyncResult, error) {
+	var result TenantSyncResult
+	if len(tenants) == 0 && !m.config.AllowEmptyTenantSync {
+		return result, ErrEmptyTenantSnapshot
+	}
+
+	var closing []*tenantDBEntry
+	m.mutex.Lock()
+	for tenantID, dsn := range tenants {
+		if tenantID == "" {
+			continue
+		}
+
+		oldDSN, ok := m.config.TenantDSNs[tenantID]
+		if !ok {
+			result.Added = append(result.Added, tenantID)
+			m.sourced[tenantID] = struct{}{}
+			// 之前可能通过DSN模板打开过
+			oldDSN, _ = m.resolveDSN(tenantID)
+		} else if oldDSN != dsn {
+			result.Updated = append(result.Updated, tenantID)
+		}
+
+		m.config.TenantDSNs[tenantID] = dsn
+		delete(m.failures, tenantID)
+		delete(m.deprovisioned, tenantID)
+		if oldDSN != dsn {
+			m.generations[tenantID]++
+			if elem, open := m.dbs[tenantID]; open {
+				closing = append(closing, m.removeEntry(elem))
+			}
+		}
+	}
+
+	for tenantID := range m.sourced {
+		if _, ok := tenants[tenantID]; ok {
+			continue
+		}
+		result.Removed = append(result.Removed, tenantID)
+		delete(m.sourced, tenantID)
+		delete(m.config.TenantDSNs, tenantID)
+		delete(m.failures, tenantID)
+		m.deprovisioned[tenantID] = struct{}{}
+		m.generations[tenantID]++
+		if elem, open := m.dbs[tenantID]; open {
+			closing = append(closing, m.removeEntry(elem))
+		}
+	}
+	m.mutex.Unlock()
+
+	// 在释放锁后关闭连接池，正在使用旧连接的调用方在宽限期内不受影响
+	for _, entry := range closing {
+		m.retireDB(entry.db)
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+	sort.Strings(result.Removed)
+	return result, nil
+}
+
+// WatchTenantSource 从租户来源加载租户并持续监听变更，直到ctx取消
+// 该方法会阻塞，通常在单独的goroutine中调用
+// 首次加载失败时返回错误，之后同步失败只记录日志并保留当前租户
+func (m *TenantDBManager) WatchTenantSource(ctx context.Context, source WatchableTenantSource) error {
+	tenants, err := source.LoadTenants(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := m.SyncTenants(tenants)
+	if err != nil {
+		return err
+	}
+	m.logSync(ctx, result)
+
+	return source.Watch(ctx, func(tenants map[string]string) {
+		result, err := m.SyncTenants(tenants)
+		if err != nil {
+			klog.CtxWarnf(ctx, "tenants not synced: %v", err)
+			return
+		}
+		m.logSync(ctx, result)
+	})
+}
+
+// logSync 记录租户同步结果
+func (m *TenantDBManager) logSync(ctx context.Context, result TenantSyncResult) {
+	if len(result.Added)+len(result.Updated)+len(result.Removed) == 0 {
+		return
+	}
+	klog.CtxInfof(ctx, "tenants synced, added: %v, updated: %v, removed: %v",
+		result.Added, result.Updated, result.Removed)
+}
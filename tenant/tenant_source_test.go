@@ -0,0 +1,157 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestTenantDBManager_SyncTenants(t *testing.T) {
+	manager := newTestTenantDBManager(t, nil)
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "tenants.yaml")
+	content := "tenant1: " + filepath.Join(dir, "tenant1.db") + "\ntenant2: " + filepath.Join(dir, "tenant2.db") + "\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tenants, err := NewFileTenantSource(file).LoadTenants(context.Background())
+	if err != nil {
+		t.Fatalf("LoadTenants() error = %v", err)
+	}
+	got, err := manager.SyncTenants(tenants)
+	if err != nil {
+		t.Fatalf("SyncTenants() error = %v", err)
+	}
+	if want := []string{"tenant1", "tenant2"}; !reflect.DeepEqual(got.Added, want) {
+		t.Errorf("SyncTenants() Added = %v, want %v", got.Added, want)
+	}
+
+	if _, err := manager.GetDB("tenant1"); err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+
+	got, err = manager.SyncTenants(map[string]string{"tenant1": filepath.Join(dir, "moved.db")})
+	want := TenantSyncResult{Updated: []string{"tenant1"}, Removed: []string{"tenant2"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncTenants() = %+v, %v, want %+v", got, err, want)
+	}
+	if stats := manager.CacheStats(); stats.Open != 0 {
+		t.Errorf("CacheStats() Open = %v, want %v", stats.Open, 0)
+	}
+}
+
+func TestTenantDBManager_SyncTenantsKeepsOtherTenants(t *testing.T) {
+	config := NewDefaultDBConfig()
+	manager := newTestTenantDBManager(t, config)
+	dir := t.TempDir()
+
+	// 静态注册和通过DSN模板访问的租户不由租户来源管理
+	manager.RegisterTenant("static", filepath.Join(dir, "static.db"))
+	for _, tenantID := range []string{"static", "template", "sourced"} {
+		if _, err := manager.GetDB(tenantID); err != nil {
+			t.Fatalf("GetDB(%v) error = %v", tenantID, err)
+		}
+	}
+	if _, err := manager.SyncTenants(map[string]string{"sourced": filepath.Join(dir, "sourced.db")}); err != nil {
+		t.Fatalf("SyncTenants() error = %v", err)
+	}
+
+	got, err := manager.SyncTenants(map[string]string{"other": filepath.Join(dir, "other.db")})
+	if err != nil {
+		t.Fatalf("SyncTenants() error = %v", err)
+	}
+	if want := []string{"sourced"}; !reflect.DeepEqual(got.Removed, want) {
+		t.Errorf("SyncTenants() Removed = %v, want %v", got.Removed, want)
+	}
+	for _, tenantID := range []string{"static", "template"} {
+		if _, err := manager.GetDB(tenantID); err != nil {
+			t.Errorf("GetDB(%v) after sync error = %v", tenantID, err)
+		}
+	}
+	if _, err := manager.GetDB("sourced"); err == nil {
+		t.Errorf("GetDB(sourced) after removal error = nil, want error")
+	}
+
+	// 租户来源读取异常时返回的空列表不会下线租户
+	if _, err := manager.SyncTenants(map[string]string{}); !errors.Is(err, ErrEmptyTenantSnapshot) {
+		t.Errorf("SyncTenants() empty error = %v, want %v", err, ErrEmptyTenantSnapshot)
+	}
+	if _, err := manager.GetDB("other"); err != nil {
+		t.Errorf("GetDB(other) after empty sync error = %v", err)
+	}
+
+	config.AllowEmptyTenantSync = true
+	got, err = manager.SyncTenants(nil)
+	if want := []string{"other"}; err != nil || !reflect.DeepEqual(got.Removed, want) {
+		t.Errorf("SyncTenants() allowed empty = %+v, %v, want Removed %v", got, err, want)
+	}
+	if _, err := manager.GetDB("static"); err != nil {
+		t.Errorf("GetDB(static) after empty sync error = %v", err)
+	}
+}
+
+func TestTenantDBManager_SyncTenantsDuringOpen(t *testing.T) {
+	dir := t.TempDir()
+	oldDSN := filepath.Join(dir, "old.db")
+	newDSN := filepath.Join(dir, "new.db")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	config := NewDefaultDBConfig()
+	config.MigrateFunc = func(db *gorm.DB) error {
+		// 第一次连接在迁移时等待同步完成
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		return nil
+	}
+	manager := newTestTenantDBManager(t, config)
+	manager.RegisterTenant("tenant1", oldDSN)
+
+	result := make(chan error, 1)
+	var db *gorm.DB
+	go func() {
+		var err error
+		db, err = manager.GetDB("tenant1")
+		result <- err
+	}()
+
+	<-started
+	if _, err := manager.SyncTenants(map[string]string{"tenant1": newDSN}); err != nil {
+		t.Fatalf("SyncTenants() error = %v", err)
+	}
+	close(release)
+	if err := <-result; err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+
+	// 使用旧DSN创建的连接池被丢弃
+	cached, err := manager.GetDB("tenant1")
+	if err != nil {
+		t.Fatalf("GetDB() error = %v", err)
+	}
+	if cached != db {
+		t.Errorf("GetDB() returned a connection that was not cached")
+	}
+	var databases []struct {
+		Seq  int
+		Name string
+		File string
+	}
+	if err := cached.Raw("PRAGMA database_list").Scan(&databases).Error; err != nil {
+		t.Fatalf("PRAGMA database_list error = %v", err)
+	}
+	if len(databases) == 0 || databases[0].File != newDSN {
+		t.Errorf("database_list = %+v, want file %v", databases, newDSN)
+	}
+}
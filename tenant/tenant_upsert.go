@@ -0,0 +1,119 @@
+package tenant
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// restrictUpsert 将ON CONFLICT的更新限制在当前租户的行内
+// Save在UPDATE未命中时会改用UpdateAll的upsert，不加限制时主键冲突会覆盖其他租户的行并改写其租户ID
+func restrictUpsert(db *gorm.DB, fields []scopedField) error {
+	c, ok := db.Statement.Clauses["ON CONFLICT"]
+	if !ok || len(fields) == 0 {
+		return nil
+	}
+	onConflict, ok := c.Expression.(clause.OnConflict)
+	if !ok || onConflict.DoNothing || (!onConflict.UpdateAll && len(onConflict.DoUpdates) == 0) {
+		return nil
+	}
+
+	switch db.Dialector.Name() {
+	case "sqlite", "postgres":
+		// DO UPDATE ... WHERE 条件不满足时冲突行保持不变
+		for _, f := range fields {
+			onConflict.Where.Exprs = append(onConflict.Where.Exprs, clause.Eq{
+				Column: clause.Column{Table: clause.CurrentTable, Name: f.field.DBName},
+				Value:  f.value,
+			})
+		}
+	case "mysql":
+		// ON DUPLICATE KEY UPDATE 不支持WHERE，每个赋值改写为 IF(租户匹配, 新值, 原值)
+		if onConflict.UpdateAll {
+			onConflict.DoUpdates = append(upsertAssignments(db), onConflict.DoUpdates...)
+			onConflict.UpdateAll = false
+			if len(onConflict.DoUpdates) == 0 {
+				onConflict.DoNothing = true
+			}
+		}
+		onConflict.DoUpdates = guardAssignments(onConflict.DoUpdates, fields)
+	default:
+		return fmt.Errorf("%w: %s", ErrUpsertNotAllowed, db.Dialector.Name())
+	}
+
+	db.Statement.AddClause(onConflict)
+	return nil
+}
+
+// upsertAssignments 按GORM展开UpdateAll的规则生成冲突时的赋值
+func upsertAssignments(db *gorm.DB) []clause.Assignment {
+	stmt := db.Statement
+	if stmt.Schema == nil {
+		return nil
+	}
+
+	selectColumns, restricted := stmt.SelectAndOmitColumns(true, true)
+	curTime := stmt.DB.NowFunc()
+	var columns []string
+	var assignments []clause.Assignment
+	for _, dbName := range stmt.Schema.DBNames {
+		field := stmt.Schema.FieldsByDBName[dbName]
+		if !field.Creatable {
+			continue
+		}
+		if v, ok := selectColumns[dbName]; !(ok && v) && (ok || restricted) {
+			continue
+		}
+		if field.PrimaryKey || (field.HasDefaultValue && field.DefaultValueInterface == nil &&
+			!strings.EqualFold(field.DefaultValue, "NULL")) || field.AutoCreateTime > 0 {
+			continue
+		}
+
+		if field.AutoUpdateTime > 0 {
+			assignment := clause.Assignment{Column: clause.Column{Name: dbName}, Value: curTime}
+			switch field.AutoUpdateTime {
+			case schema.UnixNanosecond:
+				assignment.Value = curTime.UnixNano()
+			case schema.UnixMillisecond:
+				assignment.Value = curTime.UnixMilli()
+			case schema.UnixSecond:
+				assignment.Value = curTime.Unix()
+			}
+			assignments = append(assignments, assignment)
+			continue
+		}
+		columns = append(columns, dbName)
+	}
+	return append(assignments, clause.AssignmentColumns(columns)...)
+}
+
+// guardAssignments 将赋值包装为只在冲突行属于当前租户时生效
+// 租户列的新值与条件值相同，MySQL按顺序赋值也不会改变后续赋值的判断结果
+func guardAssignments(assignments []clause.Assignment, fields []scopedField) []clause.Assignment {
+	conditions := make([]string, len(fields))
+	vars := make([]interface{}, 0, len(fields)*2+2)
+	for i, f := range fields {
+		conditions[i] = "? = ?"
+		vars = append(vars, clause.Column{Name: f.field.DBName}, f.value)
+	}
+	sql := "IF(" + strings.Join(conditions, " AND ") + ", ?, ?)"
+
+	guarded := make([]clause.Assignment, len(assignments))
+	for i, assignment := range assignments {
+		value := assignment.Value
+		if column, ok := value.(clause.Column); ok && column.Table == "excluded" {
+			value = clause.Expr{SQL: "VALUES(?)", Vars: []interface{}{clause.Column{Name: column.Name}}}
+		}
+		guarded[i] = clause.Assignment{
+			Column: assignment.Column,
+			Value: clause.Expr{
+				SQL:  sql,
+				Vars: append(append(append([]interface{}{}, vars...), value), clause.Column{Name: assignment.Column.Name}),
+			},
+		}
+	}
+	return guarded
+}
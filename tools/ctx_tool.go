@@ -77,7 +77,7 @@ func GetUserID(ctx context.Context) string {
 	return GetCtxValue(ctx, consts.UserID, "")
 }
 
-// WithTenant 向上下文中添加租户信息
+// WithTenant 向上下文中添加租户信息，写入metainfo，随RPC传递到下游服务
 //
 // 参数:
 //   - ctx: 上下文
@@ -89,7 +89,7 @@ func WithTenant(ctx context.Context, tenantID string) context.Context {
 	return SetCtxValue(ctx, consts.TenantID, tenantID)
 }
 
-// GetTenant 从上下文中获取租户ID
+// GetTenant 从上下文中获取租户ID，使用默认租户解析器按顺序查找
 //
 // 参数:
 //   - ctx: 上下文
@@ -97,7 +97,8 @@ func WithTenant(ctx context.Context, tenantID string) context.Context {
 // 返回:
 //   - 租户ID，如果不存在则返回空字符串
 func GetTenant(ctx context.Context) string {
-	return GetCtxValue(ctx, consts.TenantID, "")
+	tenantID, _ := ResolveTenant(ctx)
+	return tenantID
 }
 
 // WithTraceID 向上下文中添加追踪ID
@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bytedance/gopkg/cloud/metainfo"
+	"github.com/onebids/onecommon/consts"
+)
+
+// TenantExtractor 从上下文中提取租户ID
+//
+// 参数:
+//   - ctx: 上下文
+//
+// 返回:
+//   - 租户ID，以及是否找到非空的租户ID
+type TenantExtractor func(ctx context.Context) (string, bool)
+
+// MetainfoTenantExtractor 从Kitex metainfo中提取租户ID，WithTenant和RPC上游传递的租户ID都在这里
+//
+// 参数:
+//   - ctx: 上下文
+//
+// 返回:
+//   - 租户ID，以及是否找到
+func MetainfoTenantExtractor(ctx context.Context) (string, bool) {
+	tenantID, ok := metainfo.GetValue(ctx, consts.TenantID)
+	return tenantID, ok && tenantID != ""
+}
+
+// ContextValueTenantExtractor 从ctx.Value(consts.TenantID)中提取租户ID，兼容直接写入上下文的租户ID
+//
+// 参数:
+//   - ctx: 上下文
+//
+// 返回:
+//   - 租户ID，以及是否找到
+func ContextValueTenantExtractor(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(consts.TenantID).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// TenantResolver 租户解析器，按顺序依次调用提取器，返回第一个找到的租户ID
+type TenantResolver struct {
+	mutex      sync.RWMutex
+	extractors []TenantExtractor
+}
+
+// NewTenantResolver 创建租户解析器
+//
+// 参数:
+//   - extractors: 按查找顺序排列的提取器
+//
+// 返回:
+//   - 租户解析器
+func NewTenantResolver(extractors ...TenantExtractor) *TenantResolver {
+	return &TenantResolver{extractors: extractors}
+}
+
+// defaultTenantResolver 所有包共用的租户解析器
+var defaultTenantResolver = NewTenantResolver(MetainfoTenantExtractor, ContextValueTenantExtractor)
+
+// DefaultTenantResolver 获取所有包共用的租户解析器，GetTenant、tenant包的数据库和Redis管理器都使用它
+//
+// 返回:
+//   - 默认租户解析器，默认查找顺序为metainfo、上下文值
+func DefaultTenantResolver() *TenantResolver {
+	return defaultTenantResolver
+}
+
+// Resolve 从上下文中解析租户ID
+//
+// 参数:
+//   - ctx: 上下文
+//
+// 返回:
+//   - 租户ID，以及是否找到非空的租户ID
+func (r *TenantResolver) Resolve(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	r.mutex.RLock()
+	extractors := r.extractors
+	r.mutex.RUnlock()
+
+	for _, extractor := range extractors {
+		if tenantID, ok := extractor(ctx); ok {
+			return tenantID, true
+		}
+	}
+	return "", false
+}
+
+// SetExtractors 替换提取器及其查找顺序
+//
+// 参数:
+//   - extractors: 按查找顺序排列的提取器
+func (r *TenantResolver) SetExtractors(extractors ...TenantExtractor) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.extractors = extractors
+}
+
+// PrependExtractor 添加优先级最高的提取器，如从HTTP请求头中提取租户ID
+//
+// 参数:
+//   - extractor: 提取器
+func (r *TenantResolver) PrependExtractor(extractor TenantExtractor) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	extractors := make([]TenantExtractor, 0, len(r.extractors)+1)
+	r.extractors = append(append(extractors, extractor), r.extractors...)
+}
+
+// AppendExtractor 添加优先级最低的提取器，作为其他提取器都找不到时的兜底
+//
+// 参数:
+//   - extractor: 提取器
+func (r *TenantResolver) AppendExtractor(extractor TenantExtractor) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	extractors := make([]TenantExtractor, 0, len(r.extractors)+1)
+	r.extractors = append(append(extractors, r.extractors...), extractor)
+}
+
+// ResolveTenant 使用默认解析器从上下文中解析租户ID
+//
+// 参数:
+//   - ctx: 上下文
+//
+// 返回:
+//   - 租户ID，以及是否找到非空的租户ID
+func ResolveTenant(ctx context.Context) (string, bool) {
+	return defaultTenantResolver.Resolve(ctx)
+}
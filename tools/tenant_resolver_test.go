@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onebids/onecommon/consts"
+)
+
+type headerKey struct{}
+
+// headerTenantExtractor 测试用的自定义提取器
+func headerTenantExtractor(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(headerKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+func TestResolveTenant(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		want   string
+		wantOk bool
+	}{
+		{name: "empty", ctx: context.Background(), want: "", wantOk: false},
+		{name: "metainfo", ctx: WithTenant(context.Background(), "tenant1"), want: "tenant1", wantOk: true},
+		{name: "context value", ctx: context.WithValue(context.Background(), consts.TenantID, "tenant2"), want: "tenant2", wantOk: true},
+		{name: "empty context value", ctx: context.WithValue(context.Background(), consts.TenantID, ""), want: "", wantOk: false},
+		{name: "metainfo first", ctx: WithTenant(context.WithValue(context.Background(), consts.TenantID, "tenant2"), "tenant1"), want: "tenant1", wantOk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ResolveTenant(tt.ctx)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("ResolveTenant() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+			if got := GetTenant(tt.ctx); got != tt.want {
+				t.Errorf("GetTenant() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantResolver_Extractors(t *testing.T) {
+	ctx := WithTenant(context.WithValue(context.Background(), headerKey{}, "header"), "metainfo")
+
+	resolver := NewTenantResolver(MetainfoTenantExtractor)
+	resolver.AppendExtractor(headerTenantExtractor)
+	if got, _ := resolver.Resolve(ctx); got != "metainfo" {
+		t.Errorf("Resolve() appended = %v, want %v", got, "metainfo")
+	}
+	if got, _ := resolver.Resolve(context.WithValue(context.Background(), headerKey{}, "header")); got != "header" {
+		t.Errorf("Resolve() fallback = %v, want %v", got, "header")
+	}
+
+	resolver.PrependExtractor(headerTenantExtractor)
+	if got, _ := resolver.Resolve(ctx); got != "header" {
+		t.Errorf("Resolve() prepended = %v, want %v", got, "header")
+	}
+
+	resolver.SetExtractors(ContextValueTenantExtractor)
+	if got, ok := resolver.Resolve(ctx); ok {
+		t.Errorf("Resolve() replaced = %v, want not found", got)
+	}
+	if _, ok := resolver.Resolve(nil); ok {
+		t.Errorf("Resolve(nil) found tenant, want not found")
+	}
+}